@@ -0,0 +1,34 @@
+package MatomoTracking
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// Reasons why a response did not complete.
+const (
+	abortPanic        = "panic"
+	abortHandler      = "handler aborted" // panic(http.ErrAbortHandler)
+	abortWriteError   = "write error"
+	abortDisconnected = "client disconnected"
+)
+
+// panicReason maps a recovered panic value to an abort reason.
+func panicReason(p interface{}) string {
+	if err, ok := p.(error); ok && err == http.ErrAbortHandler {
+		return abortHandler
+	}
+	return abortPanic
+}
+
+// applyAborted turns the hit of an aborted response into an event
+// (category "Aborted", action = reason, name = path) if enabled.
+func applyAborted(req *http.Request, rec *statusRecorder, enabled bool, hit *trackingHit) {
+	if rec.abortReason == "" {
+		return
+	}
+	fmt.Println("Response aborted:", rec.abortReason)
+	if enabled {
+		hit.setEvent("Aborted", rec.abortReason, req.URL.Path)
+	}
+}
@@ -0,0 +1,176 @@
+package MatomoTracking
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// failingWriter rejects every body write, like a connection closed by the client.
+type failingWriter struct {
+	*httptest.ResponseRecorder
+}
+
+func (failingWriter) Write([]byte) (int, error) {
+	return 0, errors.New("broken pipe")
+}
+
+func TestMatchesResponseConditions_OnlyCompleted(t *testing.T) {
+	t.Parallel()
+
+	h := http.Header{}
+	rc := &ResponseConditions{OnlyCompleted: true}
+	if !matchesResponseConditions(200, h, true, rc) {
+		t.Fatalf("completed response should match")
+	}
+	if matchesResponseConditions(200, h, false, rc) {
+		t.Fatalf("aborted response should not match")
+	}
+	nested := &ResponseConditions{Not: &ResponseConditions{OnlyCompleted: true}}
+	if !matchesResponseConditions(200, h, false, nested) || matchesResponseConditions(200, h, true, nested) {
+		t.Fatalf("not(onlyCompleted) should match only aborted responses")
+	}
+}
+
+func TestStatusRecorder_WriteError(t *testing.T) {
+	t.Parallel()
+
+	rec := newStatusRecorder(failingWriter{httptest.NewRecorder()})
+	if _, err := rec.Write([]byte("body")); err == nil {
+		t.Fatalf("expected write error")
+	}
+	rec.abort(abortDisconnected)
+	if rec.abortReason != abortWriteError {
+		t.Fatalf("abortReason = %q; want first reason %q", rec.abortReason, abortWriteError)
+	}
+}
+
+func newAbortsHandler(t *testing.T, matomoURL string, onlyCompleted bool, next http.Handler) http.Handler {
+	t.Helper()
+	dc := DomainConfig{TrackingEnabled: true, IdSite: 1, AbortedEvents: true}
+	if onlyCompleted {
+		dc.ResponseConditions = &ResponseConditions{OnlyCompleted: true}
+	}
+	cfg := &Config{MatomoURL: matomoURL, Domains: map[string]DomainConfig{"example.com": dc}}
+	h, err := New(context.Background(), next, cfg, "test")
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	return h
+}
+
+func TestServeHTTP_PanicIsTrackedAndReraised(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		value  interface{}
+		reason string
+	}{
+		{"boom", abortPanic},
+		{http.ErrAbortHandler, abortHandler},
+	}
+	for _, tc := range cases {
+		matomoURL, hits := startHitCollector(t)
+		h := newAbortsHandler(t, matomoURL, false, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("partial"))
+			panic(tc.value)
+		}))
+
+		req := httptest.NewRequest(http.MethodGet, "http://example.com/report", nil)
+		req.RemoteAddr = "203.0.113.9:54321"
+		func() {
+			defer func() {
+				if p := recover(); p != tc.value {
+					t.Fatalf("recovered %v; want %v", p, tc.value)
+				}
+			}()
+			h.ServeHTTP(httptest.NewRecorder(), req)
+		}()
+
+		q := expectHit(t, hits).URL.Query()
+		if q.Get("e_c") != "Aborted" || q.Get("e_a") != tc.reason || q.Get("e_n") != "/report" {
+			t.Fatalf("unexpected event params: %v", q)
+		}
+	}
+}
+
+func TestServeHTTP_OnlyCompleted(t *testing.T) {
+	t.Parallel()
+
+	matomoURL, hits := startHitCollector(t)
+	h := newAbortsHandler(t, matomoURL, true, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("body"))
+	}))
+
+	// Client disconnected before the response completed
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	req := httptest.NewRequest(http.MethodGet, "http://example.com/download", nil).WithContext(ctx)
+	req.RemoteAddr = "203.0.113.9:54321"
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	expectNoHit(t, hits)
+
+	// Write error
+	req = httptest.NewRequest(http.MethodGet, "http://example.com/download", nil)
+	req.RemoteAddr = "203.0.113.9:54321"
+	h.ServeHTTP(failingWriter{httptest.NewRecorder()}, req)
+	expectNoHit(t, hits)
+
+	// Completed
+	req = httptest.NewRequest(http.MethodGet, "http://example.com/download", nil)
+	req.RemoteAddr = "203.0.113.9:54321"
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	if q := expectHit(t, hits).URL.Query(); q.Get("e_c") != "" {
+		t.Fatalf("completed response tracked as event: %v", q)
+	}
+}
+
+func TestServeHTTP_PanicWithoutOptIn(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name    string
+		rc      *ResponseConditions
+		wantHit bool
+	}{
+		{"default config sends nothing", nil, false},
+		{"status conditions alone send nothing", &ResponseConditions{StatusCodes: []string{"5xx"}}, false},
+		{"not onlyCompleted opts in", &ResponseConditions{Not: &ResponseConditions{OnlyCompleted: true}}, true},
+	}
+	for _, tc := range cases {
+		matomoURL, hits := startHitCollector(t)
+		cfg := &Config{
+			MatomoURL: matomoURL,
+			Domains: map[string]DomainConfig{
+				"example.com": {TrackingEnabled: true, IdSite: 1, ResponseConditions: tc.rc},
+			},
+		}
+		h, err := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			panic("boom")
+		}), cfg, "test")
+		if err != nil {
+			t.Fatalf("New() error = %v", err)
+		}
+
+		req := httptest.NewRequest(http.MethodGet, "http://example.com/x", nil)
+		req.RemoteAddr = "203.0.113.9:54321"
+		func() {
+			defer func() {
+				if p := recover(); p != "boom" {
+					t.Fatalf("%s: recovered %v; want boom", tc.name, p)
+				}
+			}()
+			h.ServeHTTP(httptest.NewRecorder(), req)
+		}()
+
+		if !tc.wantHit {
+			expectNoHit(t, hits)
+			continue
+		}
+		if q := expectHit(t, hits).URL.Query(); q.Get("e_c") != "" {
+			t.Fatalf("%s: unexpected event params: %v", tc.name, q)
+		}
+	}
+}
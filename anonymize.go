@@ -0,0 +1,115 @@
+package MatomoTracking
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// IP anonymization modes.
+const (
+	anonymizeMask = "mask" // zero trailing bits (default)
+	anonymizeHash = "hash" // replace with a keyed hash mapped into a reserved range
+)
+
+// AnonymizeIPConfig defines how client IPs are anonymized before they are sent to Matomo.
+type AnonymizeIPConfig struct {
+	// Mode is "mask" (default) or "hash".
+	Mode string `json:"mode,omitempty"`
+	// IPv4Bytes is the number of trailing IPv4 bytes to zero in mask mode (1-3, default 2).
+	IPv4Bytes int `json:"ipv4Bytes,omitempty"`
+	// IPv6PrefixLength is the number of leading IPv6 bits kept in mask mode (default 48).
+	IPv6PrefixLength int `json:"ipv6PrefixLength,omitempty"`
+	// HashKey is the HMAC key used in hash mode. Required; without it, mask mode is used.
+	HashKey string `json:"hashKey,omitempty"`
+}
+
+// defaultAnonymizeIP is applied when anonymization is required (e.g. missing
+// consent) but the domain has no anonymizeIP block.
+var defaultAnonymizeIP = &AnonymizeIPConfig{Mode: anonymizeMask, IPv4Bytes: 2, IPv6PrefixLength: 48}
+
+// anonymizeIP returns the anonymized form of an IP address according to cfg.
+// A port ("198.51.100.7:4711", "[2001:db8::1]:443") is stripped first. Values
+// that are still not IP addresses return "", so nothing identifying leaks.
+func anonymizeIP(value string, cfg *AnonymizeIPConfig) string {
+	if cfg == nil {
+		return value
+	}
+	ip := parseHostIP(value)
+	if ip == nil {
+		return ""
+	}
+
+	if cfg.Mode == anonymizeHash {
+		if cfg.HashKey != "" {
+			return hashIP(ip, cfg.HashKey)
+		}
+		// An empty key can be reversed by hashing every address; mask instead
+		fmt.Println("Hash mode without hashKey; masking the IP instead.")
+	}
+
+	if v4 := ip.To4(); v4 != nil {
+		maskBytes := cfg.IPv4Bytes
+		if maskBytes < 1 || maskBytes > 3 {
+			maskBytes = 2
+		}
+		return v4.Mask(net.CIDRMask(32-8*maskBytes, 32)).String()
+	}
+
+	prefix := cfg.IPv6PrefixLength
+	if prefix <= 0 || prefix > 128 {
+		prefix = 48
+	}
+	return ip.Mask(net.CIDRMask(prefix, 128)).String()
+}
+
+// hashIP maps an IP address to an HMAC-derived address in a reserved range:
+// 240.0.0.0/4 for IPv4 and the discard prefix 100::/64 for IPv6. The same
+// input and key always produce the same address, so visits can still be told
+// apart without revealing the original address.
+func hashIP(ip net.IP, key string) string {
+	v4 := ip.To4()
+	mac := hmac.New(sha256.New, []byte(key))
+	if v4 != nil {
+		mac.Write(v4)
+	} else {
+		mac.Write(ip)
+	}
+	sum := mac.Sum(nil)
+
+	if v4 != nil {
+		out := net.IPv4(0xF0|(sum[0]&0x0F), sum[1], sum[2], sum[3])
+		return out.String()
+	}
+
+	out := make(net.IP, net.IPv6len)
+	out[0], out[1] = 0x01, 0x00
+	copy(out[8:], sum[:8])
+	return out.String()
+}
+
+// anonymizeForwardedFor anonymizes every address in an X-Forwarded-For chain.
+// Entries that are not IP addresses are dropped.
+func anonymizeForwardedFor(xff string, cfg *AnonymizeIPConfig) string {
+	var entries []string
+	for _, entry := range strings.Split(xff, ",") {
+		if anonymized := anonymizeIP(entry, cfg); anonymized != "" {
+			entries = append(entries, anonymized)
+		}
+	}
+	return strings.Join(entries, ",")
+}
+
+// parseHostIP parses an address with or without a port.
+func parseHostIP(value string) net.IP {
+	value = strings.TrimSpace(value)
+	if ip := net.ParseIP(value); ip != nil {
+		return ip
+	}
+	if host, _, err := net.SplitHostPort(value); err == nil {
+		return net.ParseIP(host)
+	}
+	return nil
+}
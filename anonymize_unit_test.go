@@ -0,0 +1,127 @@
+package MatomoTracking
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAnonymizeIP_Mask(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		in   string
+		cfg  *AnonymizeIPConfig
+		want string
+	}{
+		{"203.0.113.9", &AnonymizeIPConfig{IPv4Bytes: 1}, "203.0.113.0"},
+		{"203.0.113.9", &AnonymizeIPConfig{}, "203.0.0.0"},
+		{"203.0.113.9", &AnonymizeIPConfig{IPv4Bytes: 3}, "203.0.0.0"},
+		{"203.0.113.9", &AnonymizeIPConfig{IPv4Bytes: 9}, "203.0.0.0"},
+		{" 198.51.100.7", defaultAnonymizeIP, "198.51.0.0"},
+		{"::ffff:203.0.113.10", defaultAnonymizeIP, "203.0.0.0"},
+		{"2001:db8:1:2:3::4", &AnonymizeIPConfig{}, "2001:db8:1::"},
+		{"2001:db8:1:2:3::4", &AnonymizeIPConfig{IPv6PrefixLength: 64}, "2001:db8:1:2::"},
+		{"198.51.100.7:4711", defaultAnonymizeIP, "198.51.0.0"},
+		{"[2001:db8:1:2::1]:443", defaultAnonymizeIP, "2001:db8:1::"},
+		{"unknown", defaultAnonymizeIP, ""},
+		{"_hidden", defaultAnonymizeIP, ""},
+		{"203.0.113.9", nil, "203.0.113.9"},
+	}
+	for _, tc := range cases {
+		if got := anonymizeIP(tc.in, tc.cfg); got != tc.want {
+			t.Fatalf("anonymizeIP(%q, %+v) = %q; want %q", tc.in, tc.cfg, got, tc.want)
+		}
+	}
+}
+
+func TestAnonymizeIP_Hash(t *testing.T) {
+	t.Parallel()
+
+	cfg := &AnonymizeIPConfig{Mode: anonymizeHash, HashKey: "secret"}
+	_, reserved4, _ := net.ParseCIDR("240.0.0.0/4")
+	_, reserved6, _ := net.ParseCIDR("100::/64")
+
+	a := anonymizeIP("203.0.113.9", cfg)
+	if a != anonymizeIP("203.0.113.9", cfg) {
+		t.Fatalf("hash is not stable")
+	}
+	if a == anonymizeIP("203.0.113.10", cfg) {
+		t.Fatalf("different IPs produced the same hash")
+	}
+	if a == anonymizeIP("203.0.113.9", &AnonymizeIPConfig{Mode: anonymizeHash, HashKey: "other"}) {
+		t.Fatalf("hash does not depend on key")
+	}
+	if !reserved4.Contains(net.ParseIP(a)) {
+		t.Fatalf("hashed IPv4 %q not in 240.0.0.0/4", a)
+	}
+
+	b := anonymizeIP("2001:db8::1", cfg)
+	if !reserved6.Contains(net.ParseIP(b)) {
+		t.Fatalf("hashed IPv6 %q not in 100::/64", b)
+	}
+}
+
+func TestAnonymizeIP_HashWithoutKeyMasks(t *testing.T) {
+	t.Parallel()
+
+	cfg := &AnonymizeIPConfig{Mode: anonymizeHash}
+	if got := anonymizeIP("203.0.113.9", cfg); got != "203.0.0.0" {
+		t.Fatalf("anonymizeIP() = %q; want masked 203.0.0.0", got)
+	}
+	if got := anonymizeIP("2001:db8:1:2::1", cfg); got != "2001:db8:1::" {
+		t.Fatalf("anonymizeIP() = %q; want masked 2001:db8:1::", got)
+	}
+}
+
+func TestAnonymizeForwardedFor(t *testing.T) {
+	t.Parallel()
+
+	xff := "198.51.100.7:4711, [2001:db8:1:2::1]:443, unknown, 203.0.113.9"
+	if got, want := anonymizeForwardedFor(xff, defaultAnonymizeIP), "198.51.0.0,2001:db8:1::,203.0.0.0"; got != want {
+		t.Fatalf("anonymizeForwardedFor() = %q; want %q", got, want)
+	}
+}
+
+func TestServeHTTP_AnonymizeIP(t *testing.T) {
+	t.Parallel()
+
+	matomoURL, hits := startHitCollector(t)
+	cfg := &Config{
+		MatomoURL: matomoURL,
+		Domains: map[string]DomainConfig{
+			"example.com": {
+				TrackingEnabled: true,
+				IdSite:          1,
+				AnonymizeIP:     &AnonymizeIPConfig{IPv4Bytes: 1},
+				PathOverrides: map[string]PathConfig{
+					"/hashed": {AnonymizeIP: &AnonymizeIPConfig{Mode: anonymizeHash, HashKey: "k"}},
+				},
+			},
+		},
+	}
+	h, err := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}), cfg, "test")
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "http://example.com/page", nil)
+	req.RemoteAddr = "203.0.113.9:54321"
+	req.Header.Set("X-Forwarded-For", "198.51.100.7")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+
+	if got := expectHit(t, hits).Header.Get("X-Forwarded-For"); got != "198.51.100.0,203.0.113.0" {
+		t.Fatalf("X-Forwarded-For = %q; want masked chain", got)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "http://example.com/hashed/page", nil)
+	req.RemoteAddr = "203.0.113.9:54321"
+	h.ServeHTTP(httptest.NewRecorder(), req)
+
+	want := anonymizeIP("203.0.113.9", &AnonymizeIPConfig{Mode: anonymizeHash, HashKey: "k"})
+	if got := expectHit(t, hits).Header.Get("X-Forwarded-For"); got != want {
+		t.Fatalf("X-Forwarded-For = %q; want %q", got, want)
+	}
+}
@@ -0,0 +1,161 @@
+package MatomoTracking
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Bot categories assigned by the User-Agent classifier.
+const (
+	botSearchEngine = "search-engine"
+	botAICrawler    = "ai-crawler"
+	botMonitor      = "monitor"
+	botHTTPLibrary  = "http-library"
+	botCrawler      = "crawler" // generic bot/crawler/spider User-Agents
+)
+
+// Bot handling modes.
+const (
+	botHandlingTrack     = "track"     // no special treatment (default)
+	botHandlingDrop      = "drop"      // do not track bots
+	botHandlingSite      = "site"      // send bot hits to BotIdSite
+	botHandlingDimension = "dimension" // tag bot hits with the category in a custom dimension
+)
+
+// BotSignature maps a User-Agent regex to a bot category.
+type BotSignature struct {
+	Pattern  string `json:"pattern,omitempty"`
+	Category string `json:"category,omitempty"`
+}
+
+// BotConfig defines how requests from bots and crawlers are handled.
+type BotConfig struct {
+	// Handling is track (default), drop, site or dimension.
+	Handling string `json:"handling,omitempty"`
+	// BotIdSite is the Matomo site bot hits are sent to in "site" mode.
+	BotIdSite int `json:"botIdSite,omitempty"`
+	// DimensionID is the custom dimension that receives the bot category in "dimension" mode.
+	DimensionID int `json:"dimensionId,omitempty"`
+}
+
+// builtinBotSignatures are checked after Config.BotSignatures, first match wins.
+var builtinBotSignatures = []BotSignature{
+	// AI crawlers and assistants
+	{`(?i)GPTBot|ChatGPT-User|OAI-SearchBot`, botAICrawler},
+	{`(?i)ClaudeBot|Claude-(Web|User|SearchBot)|anthropic-ai`, botAICrawler},
+	{`(?i)PerplexityBot|Perplexity-User`, botAICrawler},
+	{`(?i)CCBot|Bytespider|Amazonbot|cohere-ai|Diffbot|meta-externalagent|YouBot|Timpibot|ImagesiftBot`, botAICrawler},
+	// Search engines
+	{`(?i)Googlebot|Google-InspectionTool|Storebot-Google|AdsBot-Google|Mediapartners-Google`, botSearchEngine},
+	{`(?i)bingbot|BingPreview|msnbot|adidxbot`, botSearchEngine},
+	{`(?i)Applebot|DuckDuckBot|YandexBot|YandexImages|Baiduspider|Slurp|Sogou|Exabot|SeznamBot|Qwantify|PetalBot|Yeti/|MojeekBot`, botSearchEngine},
+	// Uptime monitors and health checks
+	{`(?i)UptimeRobot|Pingdom|StatusCake|Site24x7|BetterStack|Better Uptime|Uptime-Kuma|Checkly|Datadog/Synthetics|NewRelicPinger|kube-probe|ELB-HealthChecker|GoogleHC|Zabbix|Nagios|check_http|Prometheus|Blackbox Exporter`, botMonitor},
+	// Generic HTTP libraries and command line tools
+	{`(?i)^(curl|Wget|HTTPie|PostmanRuntime|insomnia)/`, botHTTPLibrary},
+	{`(?i)python-requests|python-urllib|aiohttp|python-httpx|Scrapy`, botHTTPLibrary},
+	{`(?i)Go-http-client|Java/|okhttp|Apache-HttpClient|axios/|node-fetch|undici|libwww-perl|GuzzleHttp|Faraday|Ruby|reqwest|Dart/`, botHTTPLibrary},
+}
+
+// genericBotPattern catches anything else that calls itself a bot, crawler or
+// spider. It is not applied to regular browser User-Agents, because device
+// names such as "CUBOT" end in "bot" as well. Crawlers that imitate a browser
+// mark themselves with "compatible;".
+var (
+	genericBotPattern = regexp.MustCompile(`(?i)(^|[^a-z])(\w+[-_]?)?(bot|crawler|spider)\b`)
+	browserUserAgent  = regexp.MustCompile(`^Mozilla/5\.0 \([^)]*\) (AppleWebKit|Gecko)/`)
+)
+
+// botMatcher is a compiled BotSignature.
+type botMatcher struct {
+	re       *regexp.Regexp
+	category string
+}
+
+// builtinBotMatchers are compiled once at startup.
+var builtinBotMatchers = mustCompileBotSignatures(builtinBotSignatures)
+
+func mustCompileBotSignatures(signatures []BotSignature) []botMatcher {
+	matchers := make([]botMatcher, 0, len(signatures))
+	for _, sig := range signatures {
+		matchers = append(matchers, botMatcher{re: regexp.MustCompile(sig.Pattern), category: sig.Category})
+	}
+	return matchers
+}
+
+// compileBotSignatures compiles the custom signatures of Config.BotSignatures.
+// Invalid patterns are logged and skipped.
+func compileBotSignatures(signatures []BotSignature) []botMatcher {
+	var matchers []botMatcher
+	for _, sig := range signatures {
+		re, err := regexp.Compile(sig.Pattern)
+		if err != nil {
+			fmt.Println("Error compiling bot signature:", err)
+			continue
+		}
+		matchers = append(matchers, botMatcher{re: re, category: sig.Category})
+	}
+	return matchers
+}
+
+// classifyBot returns the category and matched signature of a bot User-Agent.
+// Custom signatures are checked before the built-in ones. An empty category
+// means the User-Agent does not look like a bot.
+func classifyBot(userAgent string, custom []botMatcher) (category, signature string) {
+	if userAgent == "" {
+		// Browsers always send a User-Agent
+		return botHTTPLibrary, "<empty>"
+	}
+
+	for _, matchers := range [][]botMatcher{custom, builtinBotMatchers} {
+		for _, m := range matchers {
+			if match := m.re.FindString(userAgent); match != "" {
+				return m.category, match
+			}
+		}
+	}
+
+	if browserUserAgent.MatchString(userAgent) && !strings.Contains(userAgent, "compatible;") {
+		return "", ""
+	}
+	if match := genericBotPattern.FindStringSubmatch(userAgent); match != nil {
+		return botCrawler, match[2] + match[3]
+	}
+	return "", ""
+}
+
+// applyBotHandling classifies the request's User-Agent and applies the bot
+// handling to hit. It returns false if the request must not be tracked.
+func applyBotHandling(req *http.Request, bc *BotConfig, custom []botMatcher, hit *trackingHit) bool {
+	if bc == nil {
+		return true
+	}
+
+	category, signature := classifyBot(req.Header.Get("User-Agent"), custom)
+	if category == "" {
+		return true
+	}
+
+	handling := bc.Handling
+	if handling == "" {
+		handling = botHandlingTrack
+	}
+	fmt.Printf("Bot detected: category=%s signature=%q handling=%s\n", category, signature, handling)
+
+	switch handling {
+	case botHandlingDrop:
+		return false
+	case botHandlingSite:
+		if bc.BotIdSite > 0 {
+			hit.params.Set("idsite", strconv.Itoa(bc.BotIdSite))
+		}
+	case botHandlingDimension:
+		if bc.DimensionID > 0 {
+			hit.params.Set("dimension"+strconv.Itoa(bc.DimensionID), category)
+		}
+	}
+	return true
+}
@@ -0,0 +1,122 @@
+package MatomoTracking
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClassifyBot(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		ua   string
+		want string
+	}{
+		{"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/126.0 Safari/537.36", ""},
+		{"Mozilla/5.0 (iPhone; CPU iPhone OS 17_5 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.5 Mobile/15E148 Safari/604.1", ""},
+		{"Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)", botSearchEngine},
+		{"Mozilla/5.0 (compatible; bingbot/2.0; +http://www.bing.com/bingbot.htm)", botSearchEngine},
+		{"Mozilla/5.0 AppleWebKit/537.36 (KHTML, like Gecko; compatible; GPTBot/1.2; +https://openai.com/gptbot)", botAICrawler},
+		{"Mozilla/5.0 AppleWebKit/537.36 (KHTML, like Gecko; compatible; ClaudeBot/1.0; +claudebot@anthropic.com)", botAICrawler},
+		{"Mozilla/5.0+(compatible; UptimeRobot/2.0; http://www.uptimerobot.com/)", botMonitor},
+		{"kube-probe/1.29", botMonitor},
+		{"curl/8.5.0", botHTTPLibrary},
+		{"python-requests/2.31.0", botHTTPLibrary},
+		{"Go-http-client/1.1", botHTTPLibrary},
+		{"", botHTTPLibrary},
+		{"Mozilla/5.0 (compatible; SomeNewBot/0.1)", botCrawler},
+		{"Mozilla/5.0 (compatible; MJ12bot/v1.4.8; http://mj12bot.com/)", botCrawler},
+		{"Mozilla/5.0 (compatible; AhrefsBot/7.0; +http://ahrefs.com/robot/)", botCrawler},
+		{"Mozilla/5.0 AppleWebKit/537.36 (KHTML, like Gecko; compatible; SomeCrawler/2.0) Chrome/120.0 Safari/537.36", botCrawler},
+		{"my_spider/1.0", botCrawler},
+		// Device names ending in "bot" are not bots
+		{"Mozilla/5.0 (Linux; Android 10; CUBOT X30) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0 Mobile Safari/537.36", ""},
+		{"Mozilla/5.0 (Linux; Android 12; CUBOT_KINGKONG_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0 Mobile Safari/537.36", ""},
+	}
+	for _, tc := range cases {
+		got, sig := classifyBot(tc.ua, nil)
+		if got != tc.want {
+			t.Fatalf("classifyBot(%q) = %q (signature %q); want %q", tc.ua, got, sig, tc.want)
+		}
+		if got != "" && sig == "" {
+			t.Fatalf("classifyBot(%q) returned no signature", tc.ua)
+		}
+	}
+
+	// Custom signatures take precedence over the built-in ones
+	custom := []BotSignature{{Pattern: `(?i)curl/`, Category: "internal"}, {Pattern: `(`, Category: "broken"}}
+	if got, _ := classifyBot("curl/8.5.0", compileBotSignatures(custom)); got != "internal" {
+		t.Fatalf("custom signature not applied, got %q", got)
+	}
+}
+
+func TestApplyBotHandling(t *testing.T) {
+	t.Parallel()
+
+	req := httptest.NewRequest(http.MethodGet, "http://example.com/", nil)
+	req.Header.Set("User-Agent", "Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)")
+
+	cases := []struct {
+		name      string
+		bc        *BotConfig
+		wantTrack bool
+		param     string
+		value     string
+	}{
+		{"nil config", nil, true, "", ""},
+		{"track", &BotConfig{}, true, "", ""},
+		{"drop", &BotConfig{Handling: "drop"}, false, "", ""},
+		{"site", &BotConfig{Handling: "site", BotIdSite: 9}, true, "idsite", "9"},
+		{"dimension", &BotConfig{Handling: "dimension", DimensionID: 4}, true, "dimension4", botSearchEngine},
+	}
+	for _, tc := range cases {
+		hit := trackingHit{params: map[string][]string{}}
+		if got := applyBotHandling(req, tc.bc, nil, &hit); got != tc.wantTrack {
+			t.Fatalf("%s: applyBotHandling() = %v; want %v", tc.name, got, tc.wantTrack)
+		}
+		if tc.param != "" && hit.params.Get(tc.param) != tc.value {
+			t.Fatalf("%s: %s = %q; want %q", tc.name, tc.param, hit.params.Get(tc.param), tc.value)
+		}
+		if tc.param == "" && len(hit.params) != 0 {
+			t.Fatalf("%s: unexpected params %v", tc.name, hit.params)
+		}
+	}
+}
+
+func TestServeHTTP_BotSite(t *testing.T) {
+	t.Parallel()
+
+	matomoURL, hits := startHitCollector(t)
+	cfg := &Config{
+		MatomoURL: matomoURL,
+		Domains: map[string]DomainConfig{
+			"example.com": {
+				TrackingEnabled: true,
+				IdSite:          1,
+				Bots:            &BotConfig{Handling: "site", BotIdSite: 99},
+			},
+		},
+	}
+	h, err := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}), cfg, "test")
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "http://example.com/page", nil)
+	req.RemoteAddr = "203.0.113.9:54321"
+	req.Header.Set("User-Agent", "curl/8.5.0")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	if got := expectHit(t, hits).URL.Query().Get("idsite"); got != "99" {
+		t.Fatalf("idsite = %q; want bot site 99", got)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "http://example.com/page", nil)
+	req.RemoteAddr = "203.0.113.9:54321"
+	req.Header.Set("User-Agent", "Mozilla/5.0 (X11; Linux x86_64; rv:128.0) Gecko/20100101 Firefox/128.0")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	if got := expectHit(t, hits).URL.Query().Get("idsite"); got != "1" {
+		t.Fatalf("idsite = %q; want 1", got)
+	}
+}
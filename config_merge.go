@@ -0,0 +1,171 @@
+package MatomoTracking
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// overrideFields copies every set field of src onto the field of the same name
+// in dst. A field is set if it is a non-nil pointer, slice or map, or a non-zero
+// value. Pointers are dereferenced when dst holds the plain value, so a
+// PathConfig field *T overrides the DomainConfig field T. Fields without a
+// counterpart in dst are ignored.
+func overrideFields(dst, src reflect.Value) {
+	srcType := src.Type()
+	for i := 0; i < srcType.NumField(); i++ {
+		field := src.Field(i)
+		if !isSetField(field) {
+			continue
+		}
+		target := dst.FieldByName(srcType.Field(i).Name)
+		if !target.IsValid() || !target.CanSet() {
+			continue
+		}
+		switch {
+		case field.Type().AssignableTo(target.Type()):
+			target.Set(field)
+		case field.Kind() == reflect.Ptr && field.Elem().Type().AssignableTo(target.Type()):
+			target.Set(field.Elem())
+		default:
+			fmt.Printf("Cannot override field %s: %s is not assignable to %s\n", srcType.Field(i).Name, field.Type(), target.Type())
+		}
+	}
+}
+
+func isSetField(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Slice, reflect.Map, reflect.Interface:
+		return !v.IsNil()
+	default:
+		return !v.IsZero()
+	}
+}
+
+// flattenPathOverrides turns nested path overrides into a flat map keyed by the
+// full path prefix. A nested prefix is relative to its parent ("/docs" → "/api"
+// becomes "/docs/api"), and a nested override inherits every field of its
+// parent that it does not set itself. Explicit top-level prefixes take
+// precedence over nested ones with the same full prefix. If several nested
+// overrides resolve to the same prefix, the most deeply nested one wins, then
+// the one with the longest parent prefix, then the lexically first parent and key.
+func flattenPathOverrides(overrides map[string]PathConfig) map[string]PathConfig {
+	nested := map[string]nestedOverride{}
+	for _, prefix := range sortedKeys(overrides) {
+		flattenNested(nested, overrides, prefix, overrides[prefix], 1)
+	}
+
+	flat := make(map[string]PathConfig, len(overrides)+len(nested))
+	for prefix, override := range overrides {
+		flat[prefix] = withoutNested(override)
+	}
+	for prefix, n := range nested {
+		flat[prefix] = n.config
+	}
+	return flat
+}
+
+// nestedOverride is a flattened nested override and where it was declared.
+type nestedOverride struct {
+	config PathConfig
+	depth  int    // nesting level below the top-level override
+	parent string // full prefix of the parent
+	key    string // prefix as written in the parent
+}
+
+// outranks reports whether n wins over other for the same full prefix.
+func (n nestedOverride) outranks(other nestedOverride) bool {
+	if n.depth != other.depth {
+		return n.depth > other.depth
+	}
+	if len(n.parent) != len(other.parent) {
+		return len(n.parent) > len(other.parent)
+	}
+	if n.parent != other.parent {
+		return n.parent < other.parent
+	}
+	return n.key < other.key
+}
+
+func flattenNested(nested map[string]nestedOverride, topLevel map[string]PathConfig, parentPrefix string, parent PathConfig, depth int) {
+	for _, nestedPrefix := range sortedKeys(parent.PathOverrides) {
+		child := parent.PathOverrides[nestedPrefix]
+		prefix := strings.TrimSuffix(parentPrefix, "/") + "/" + strings.TrimPrefix(nestedPrefix, "/")
+		if _, exists := topLevel[prefix]; exists {
+			fmt.Println("Nested path override shadowed by top-level override:", prefix)
+			continue
+		}
+		inherited := withoutNested(parent)
+		overrideFields(reflect.ValueOf(&inherited).Elem(), reflect.ValueOf(withoutNested(child)))
+		composeListModifiers(&inherited, parent, child)
+
+		candidate := nestedOverride{config: inherited, depth: depth, parent: parentPrefix, key: nestedPrefix}
+		if existing, exists := nested[prefix]; exists {
+			winner := existing
+			if candidate.outranks(existing) {
+				winner = candidate
+			}
+			fmt.Printf("Conflicting nested path overrides for %s; using the one declared under %s as %q\n", prefix, winner.parent, winner.key)
+			nested[prefix] = winner
+		} else {
+			nested[prefix] = candidate
+		}
+
+		// Deeper levels inherit the merged settings of this level
+		inherited.PathOverrides = child.PathOverrides
+		flattenNested(nested, topLevel, prefix, inherited, depth+1)
+	}
+}
+
+func sortedKeys(m map[string]PathConfig) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// composeListModifiers sets the list modifiers of dst to the combined effect
+// of applying the parent's modifiers and then the child's. Removals run before
+// appends, so the child's removals also cancel the parent's appends. If the
+// child replaces a list with the plain field, the parent's modifiers for that
+// list no longer apply.
+func composeListModifiers(dst *PathConfig, parent, child PathConfig) {
+	dst.ExcludedPathsRemove, dst.ExcludedPathsAppend = composeStringModifiers(child.ExcludedPaths != nil,
+		parent.ExcludedPathsRemove, parent.ExcludedPathsAppend, child.ExcludedPathsRemove, child.ExcludedPathsAppend)
+	dst.IncludedPathsRemove, dst.IncludedPathsAppend = composeStringModifiers(child.IncludedPaths != nil,
+		parent.IncludedPathsRemove, parent.IncludedPathsAppend, child.IncludedPathsRemove, child.IncludedPathsAppend)
+	dst.ExcludedIPsRemove, dst.ExcludedIPsAppend = composeStringModifiers(child.ExcludedIPs != nil,
+		parent.ExcludedIPsRemove, parent.ExcludedIPsAppend, child.ExcludedIPsRemove, child.ExcludedIPsAppend)
+	dst.IncludedIPsRemove, dst.IncludedIPsAppend = composeStringModifiers(child.IncludedIPs != nil,
+		parent.IncludedIPsRemove, parent.IncludedIPsAppend, child.IncludedIPsRemove, child.IncludedIPsAppend)
+
+	if child.Goals != nil {
+		dst.GoalsRemove, dst.GoalsAppend = child.GoalsRemove, child.GoalsAppend
+	} else {
+		dst.GoalsRemove = mergeIntList(parent.GoalsRemove, child.GoalsRemove)
+		dst.GoalsAppend = mergeGoals(parent.GoalsAppend, child.GoalsAppend, child.GoalsRemove)
+	}
+	if child.Dimensions != nil {
+		dst.DimensionsRemove, dst.DimensionsAppend = child.DimensionsRemove, child.DimensionsAppend
+	} else {
+		dst.DimensionsRemove = mergeIntList(parent.DimensionsRemove, child.DimensionsRemove)
+		dst.DimensionsAppend = mergeDimensions(parent.DimensionsAppend, child.DimensionsAppend, child.DimensionsRemove)
+	}
+}
+
+// composeStringModifiers returns the remove and append lists of a child whose
+// parent has its own; replaced means the child sets the plain list.
+func composeStringModifiers(replaced bool, parentRemove, parentAppend, childRemove, childAppend []string) ([]string, []string) {
+	if replaced {
+		return childRemove, childAppend
+	}
+	return mergeStringList(parentRemove, childRemove, nil), mergeStringList(parentAppend, childAppend, childRemove)
+}
+
+func withoutNested(pc PathConfig) PathConfig {
+	pc.PathOverrides = nil
+	return pc
+}
@@ -0,0 +1,243 @@
+package MatomoTracking
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+// Every per-domain setting must be overridable per path.
+func TestPathConfigParity(t *testing.T) {
+	t.Parallel()
+
+	domainOnly := map[string]bool{"Inheritance": true}
+	domainType := reflect.TypeOf(DomainConfig{})
+	pathType := reflect.TypeOf(PathConfig{})
+	for i := 0; i < domainType.NumField(); i++ {
+		df := domainType.Field(i)
+		if domainOnly[df.Name] {
+			continue
+		}
+		pf, ok := pathType.FieldByName(df.Name)
+		if !ok {
+			t.Fatalf("PathConfig lacks field %s", df.Name)
+		}
+		if pf.Type != df.Type && !(pf.Type.Kind() == reflect.Ptr && pf.Type.Elem() == df.Type) {
+			t.Fatalf("PathConfig.%s has type %s; want %s or *%s", df.Name, pf.Type, df.Type, df.Type)
+		}
+		if pf.Tag.Get("json") != df.Tag.Get("json") {
+			t.Fatalf("PathConfig.%s has JSON tag %q; want %q", df.Name, pf.Tag.Get("json"), df.Tag.Get("json"))
+		}
+	}
+}
+
+func TestMergeConfigs_Generic(t *testing.T) {
+	t.Parallel()
+
+	enabled, site, mode, url := false, 9, trackAtHeaders, "http://other-matomo/matomo.php"
+	base := DomainConfig{
+		TrackingEnabled: true,
+		IdSite:          1,
+		ExcludedPaths:   []string{`\.php$`},
+		BulkTracking:    true,
+		Consent:         &ConsentConfig{Cookie: "consent"},
+		PathOverrides:   map[string]PathConfig{"/a": {}},
+	}
+	override := PathConfig{
+		TrackingEnabled: &enabled,
+		IdSite:          &site,
+		TrackAt:         &mode,
+		MatomoURL:       &url,
+		UserID:          &UserIDConfig{Source: userIDHeader, Name: "X-User"},
+		PathOverrides:   map[string]PathConfig{"/nested": {}},
+	}
+	merged := mergeConfigs(base, override)
+
+	if merged.TrackingEnabled || merged.IdSite != 9 || merged.TrackAt != trackAtHeaders || merged.MatomoURL != url {
+		t.Fatalf("value fields not overridden: %+v", merged)
+	}
+	if merged.UserID == nil || merged.UserID.Name != "X-User" {
+		t.Fatalf("pointer field not overridden: %+v", merged.UserID)
+	}
+	if !merged.BulkTracking || merged.Consent.Cookie != "consent" || len(merged.ExcludedPaths) != 1 {
+		t.Fatalf("unset fields not inherited: %+v", merged)
+	}
+	if _, ok := merged.PathOverrides["/a"]; !ok || len(merged.PathOverrides) != 1 {
+		t.Fatalf("path overrides changed by merge: %v", merged.PathOverrides)
+	}
+}
+
+func TestFlattenPathOverrides(t *testing.T) {
+	t.Parallel()
+
+	docsSite, apiSite, topSite := 2, 3, 4
+	enabled := false
+	flat := flattenPathOverrides(map[string]PathConfig{
+		"/docs": {
+			IdSite:        &docsSite,
+			ExcludedPaths: []string{`\.pdf$`},
+			PathOverrides: map[string]PathConfig{
+				"/api": {
+					IdSite:        &apiSite,
+					PathOverrides: map[string]PathConfig{"v1": {TrackingEnabled: &enabled}},
+				},
+				"/legacy": {TrackingEnabled: &enabled},
+			},
+		},
+		"/docs/legacy": {IdSite: &topSite},
+	})
+
+	if len(flat) != 4 {
+		t.Fatalf("unexpected prefixes: %v", flat)
+	}
+	if api := flat["/docs/api"]; *api.IdSite != 3 || len(api.ExcludedPaths) != 1 || api.PathOverrides != nil {
+		t.Fatalf("/docs/api = %+v", api)
+	}
+	if v1 := flat["/docs/api/v1"]; *v1.IdSite != 3 || *v1.TrackingEnabled || len(v1.ExcludedPaths) != 1 {
+		t.Fatalf("/docs/api/v1 = %+v", v1)
+	}
+	if legacy := flat["/docs/legacy"]; *legacy.IdSite != 4 || legacy.TrackingEnabled != nil {
+		t.Fatalf("top-level override should shadow nested one: %+v", legacy)
+	}
+	if docs := flat["/docs"]; docs.PathOverrides != nil {
+		t.Fatalf("nested overrides left in /docs")
+	}
+}
+
+func TestFlattenPathOverrides_CollidingNestedPrefixes(t *testing.T) {
+	t.Parallel()
+
+	shallow, deep, outer, inner := 2, 3, 4, 5
+	for i := 0; i < 20; i++ {
+		flat := flattenPathOverrides(map[string]PathConfig{
+			"/a": {
+				PathOverrides: map[string]PathConfig{
+					"/b/c": {IdSite: &shallow},
+					"/b":   {PathOverrides: map[string]PathConfig{"/c": {IdSite: &deep}}},
+					"/x/y": {IdSite: &outer},
+				},
+			},
+			"/a/x": {PathOverrides: map[string]PathConfig{"/y": {IdSite: &inner}}},
+		})
+
+		if got := flat["/a/b/c"]; got.IdSite == nil || *got.IdSite != deep {
+			t.Fatalf("deepest nested override should win for /a/b/c: %+v", got)
+		}
+		if got := flat["/a/x/y"]; got.IdSite == nil || *got.IdSite != inner {
+			t.Fatalf("longest parent prefix should win for /a/x/y: %+v", got)
+		}
+	}
+}
+
+func TestServeHTTP_NestedOverridesAndMatomoURL(t *testing.T) {
+	t.Parallel()
+
+	defaultURL, defaultHits := startHitCollector(t)
+	docsURL, docsHits := startHitCollector(t)
+	cfg := &Config{
+		MatomoURL: defaultURL,
+		Domains: map[string]DomainConfig{
+			"example.com": {
+				TrackingEnabled: true,
+				IdSite:          1,
+				PathOverrides: map[string]PathConfig{
+					"/docs": {
+						MatomoURL: &docsURL,
+						PathOverrides: map[string]PathConfig{
+							"/api": {Dimensions: []DimensionConfig{{ID: 1, Source: dimensionStatic, Value: "api"}}},
+						},
+					},
+				},
+			},
+		},
+	}
+	h, err := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}), cfg, "test")
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if _, ok := cfg.Domains["example.com"].PathOverrides["/docs/api"]; ok {
+		t.Fatalf("New() modified the caller's config")
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "http://example.com/docs/api/users", nil)
+	req.RemoteAddr = "203.0.113.9:54321"
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	if q := expectHit(t, docsHits).URL.Query(); q.Get("dimension1") != "api" {
+		t.Fatalf("unexpected params: %v", q)
+	}
+	expectNoHit(t, defaultHits)
+
+	req = httptest.NewRequest(http.MethodGet, "http://example.com/blog", nil)
+	req.RemoteAddr = "203.0.113.9:54321"
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	expectHit(t, defaultHits)
+}
+
+func TestFlattenPathOverrides_NestedRemoveCancelsParentAppend(t *testing.T) {
+	t.Parallel()
+
+	for _, mode := range []string{inheritanceLongest, inheritanceCascade} {
+		dc := DomainConfig{
+			TrackingEnabled: true,
+			IdSite:          1,
+			Inheritance:     mode,
+			ExcludedPaths:   []string{"a"},
+			Goals:           []GoalConfig{{ID: 1}},
+			PathOverrides: flattenPathOverrides(map[string]PathConfig{
+				"/docs": {
+					ExcludedPathsAppend: []string{"x"},
+					GoalsAppend:         []GoalConfig{{ID: 5}},
+					PathOverrides: map[string]PathConfig{
+						"/api": {
+							ExcludedPathsRemove: []string{"x"},
+							GoalsRemove:         []int{5},
+							GoalsAppend:         []GoalConfig{{ID: 6}},
+						},
+					},
+				},
+			}),
+		}
+
+		docs, _ := resolvePathOverrides(dc, "/docs/guide")
+		if !reflect.DeepEqual(docs.ExcludedPaths, []string{"a", "x"}) || !reflect.DeepEqual(docs.Goals, []GoalConfig{{ID: 1}, {ID: 5}}) {
+			t.Fatalf("%s: /docs excludedPaths = %v, goals = %v", mode, docs.ExcludedPaths, docs.Goals)
+		}
+		api, _ := resolvePathOverrides(dc, "/docs/api/users")
+		if !reflect.DeepEqual(api.ExcludedPaths, []string{"a"}) || !reflect.DeepEqual(api.Goals, []GoalConfig{{ID: 1}, {ID: 6}}) {
+			t.Fatalf("%s: /docs/api excludedPaths = %v, goals = %v", mode, api.ExcludedPaths, api.Goals)
+		}
+	}
+}
+
+func TestFlattenPathOverrides_NestedReplaceDropsParentModifiers(t *testing.T) {
+	t.Parallel()
+
+	for _, mode := range []string{inheritanceLongest, inheritanceCascade} {
+		dc := DomainConfig{
+			TrackingEnabled: true,
+			IdSite:          1,
+			Inheritance:     mode,
+			Goals:           []GoalConfig{{ID: 1}},
+			PathOverrides: flattenPathOverrides(map[string]PathConfig{
+				"/docs": {
+					ExcludedPathsAppend: []string{"a"},
+					GoalsAppend:         []GoalConfig{{ID: 5}},
+					PathOverrides: map[string]PathConfig{
+						"/api": {
+							ExcludedPaths:       []string{"b"},
+							Goals:               []GoalConfig{{ID: 7}},
+							ExcludedPathsAppend: []string{"c"},
+						},
+					},
+				},
+			}),
+		}
+
+		api, _ := resolvePathOverrides(dc, "/docs/api/users")
+		if !reflect.DeepEqual(api.ExcludedPaths, []string{"b", "c"}) || !reflect.DeepEqual(api.Goals, []GoalConfig{{ID: 7}}) {
+			t.Fatalf("%s: /docs/api excludedPaths = %v, goals = %v", mode, api.ExcludedPaths, api.Goals)
+		}
+	}
+}
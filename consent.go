@@ -0,0 +1,163 @@
+package MatomoTracking
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Consent modes decide how a request is tracked depending on the visitor's consent.
+const (
+	consentFull       = ""           // consent granted (or no consent config): regular hit
+	consentSkip       = "skip"       // do not track at all
+	consentAnonymous  = "anonymous"  // track with anonymized client IPs and without visitor identifiers
+	consentCookieless = "cookieless" // track without visitor identifiers
+)
+
+// defaultGrantedPattern is used when ConsentConfig.GrantedPattern is empty.
+const defaultGrantedPattern = `(?i)^(true|1|yes)$`
+
+// ConsentConfig describes where the consent banner stores the visitor's
+// decision and what to do if analytics consent has not been granted.
+type ConsentConfig struct {
+	// Cookie holding the consent record (e.g. "cookie_consent").
+	Cookie string `json:"cookie,omitempty"`
+	// Header holding the consent record. Takes precedence over Cookie if both are set.
+	Header string `json:"header,omitempty"`
+	// JSONPath selects a value inside a JSON-encoded consent record, dot-separated (e.g. "categories.analytics").
+	// Empty = match GrantedPattern against the raw value.
+	JSONPath string `json:"jsonPath,omitempty"`
+	// GrantedPattern is a regex the selected value must match for consent to count as granted.
+	// Empty = "true", "1" or "yes" (case-insensitive).
+	GrantedPattern string `json:"grantedPattern,omitempty"`
+	// TCF additionally requires an IAB TCF v2 consent string granting the configured purposes.
+	TCF *TCFConfig `json:"tcf,omitempty"`
+	// OnMissing is the behavior when consent is missing or not granted: skip (default), anonymous or cookieless.
+	OnMissing string `json:"onMissing,omitempty"`
+}
+
+// consentMode returns how the request may be tracked according to cc.
+// A nil config means consent is not required.
+func consentMode(req *http.Request, cc *ConsentConfig) string {
+	if cc == nil {
+		return consentFull
+	}
+
+	if consentGranted(req, cc) {
+		fmt.Println("Consent granted.")
+		return consentFull
+	}
+
+	mode := cc.OnMissing
+	switch mode {
+	case consentAnonymous, consentCookieless:
+	default:
+		mode = consentSkip
+	}
+	fmt.Println("Consent missing or not granted; mode:", mode)
+	return mode
+}
+
+func consentGranted(req *http.Request, cc *ConsentConfig) bool {
+	if cc.TCF != nil && !tcfConsentGranted(req, cc.TCF) {
+		return false
+	}
+	if cc.Cookie == "" && cc.Header == "" {
+		// Only the TC string decides (or nothing is configured to grant consent)
+		return cc.TCF != nil
+	}
+
+	var raw string
+	switch {
+	case cc.Header != "":
+		raw = req.Header.Get(cc.Header)
+	case cc.Cookie != "":
+		cookie, err := req.Cookie(cc.Cookie)
+		if err != nil {
+			return false
+		}
+		raw = cookie.Value
+	}
+	if raw == "" {
+		return false
+	}
+
+	// CMPs commonly URL-encode the cookie value
+	if unescaped, err := url.QueryUnescape(raw); err == nil {
+		raw = unescaped
+	}
+
+	pattern := cc.GrantedPattern
+	if pattern == "" {
+		pattern = defaultGrantedPattern
+	}
+	re, err := cachedRegexp(pattern)
+	if err != nil {
+		fmt.Println("Error compiling consent pattern:", err)
+		return false
+	}
+
+	if cc.JSONPath == "" {
+		return re.MatchString(raw)
+	}
+
+	var doc interface{}
+	if err := json.Unmarshal([]byte(raw), &doc); err != nil {
+		fmt.Println("Error decoding consent record:", err)
+		return false
+	}
+	value, ok := lookupJSONPath(doc, cc.JSONPath)
+	if !ok {
+		return false
+	}
+
+	// For lists (e.g. accepted categories), one matching element is enough
+	if list, isList := value.([]interface{}); isList {
+		for _, v := range list {
+			if re.MatchString(jsonScalarString(v)) {
+				return true
+			}
+		}
+		return false
+	}
+	return re.MatchString(jsonScalarString(value))
+}
+
+// lookupJSONPath walks a decoded JSON document along a dot-separated path.
+// Numeric segments index into arrays.
+func lookupJSONPath(doc interface{}, path string) (interface{}, bool) {
+	current := doc
+	for _, segment := range strings.Split(path, ".") {
+		switch node := current.(type) {
+		case map[string]interface{}:
+			next, ok := node[segment]
+			if !ok {
+				return nil, false
+			}
+			current = next
+		case []interface{}:
+			idx, err := strconv.Atoi(segment)
+			if err != nil || idx < 0 || idx >= len(node) {
+				return nil, false
+			}
+			current = node[idx]
+		default:
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+func jsonScalarString(v interface{}) string {
+	switch value := v.(type) {
+	case string:
+		return value
+	case nil:
+		return ""
+	default:
+		return fmt.Sprint(value)
+	}
+}
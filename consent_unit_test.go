@@ -0,0 +1,106 @@
+package MatomoTracking
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestConsentMode(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name   string
+		cc     *ConsentConfig
+		cookie string
+		header string
+		want   string
+	}{
+		{"nil config", nil, "", "", consentFull},
+		{"cookie true", &ConsentConfig{Cookie: "consent"}, "true", "", consentFull},
+		{"cookie missing", &ConsentConfig{Cookie: "consent"}, "", "", consentSkip},
+		{"cookie false", &ConsentConfig{Cookie: "consent", OnMissing: "anonymous"}, "false", "", consentAnonymous},
+		{"cookieless fallback", &ConsentConfig{Cookie: "consent", OnMissing: "cookieless"}, "", "", consentCookieless},
+		{"unknown fallback skips", &ConsentConfig{Cookie: "consent", OnMissing: "bogus"}, "", "", consentSkip},
+		{"pattern", &ConsentConfig{Cookie: "consent", GrantedPattern: `statistics:true`}, "{necessary:true,statistics:true}", "", consentFull},
+		{"pattern mismatch", &ConsentConfig{Cookie: "consent", GrantedPattern: `statistics:true`}, "{necessary:true,statistics:false}", "", consentSkip},
+		{"json path bool", &ConsentConfig{Cookie: "consent", JSONPath: "analytics"}, url.QueryEscape(`{"analytics":true}`), "", consentFull},
+		{"json path nested", &ConsentConfig{Cookie: "consent", JSONPath: "services.matomo"}, url.QueryEscape(`{"services":{"matomo":false}}`), "", consentSkip},
+		{"json path list", &ConsentConfig{Cookie: "consent", JSONPath: "categories", GrantedPattern: "^analytics$"}, url.QueryEscape(`{"categories":["necessary","analytics"]}`), "", consentFull},
+		{"json path index", &ConsentConfig{Cookie: "consent", JSONPath: "categories.0", GrantedPattern: "^analytics$"}, url.QueryEscape(`{"categories":["necessary","analytics"]}`), "", consentSkip},
+		{"invalid json", &ConsentConfig{Cookie: "consent", JSONPath: "analytics"}, "not-json", "", consentSkip},
+		{"header", &ConsentConfig{Header: "X-Consent", Cookie: "consent"}, "false", "yes", consentFull},
+	}
+
+	for _, tc := range cases {
+		req := httptest.NewRequest(http.MethodGet, "http://example.com/", nil)
+		if tc.cookie != "" {
+			req.AddCookie(&http.Cookie{Name: "consent", Value: tc.cookie})
+		}
+		if tc.header != "" {
+			req.Header.Set("X-Consent", tc.header)
+		}
+		if got := consentMode(req, tc.cc); got != tc.want {
+			t.Fatalf("%s: consentMode() = %q; want %q", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestServeHTTP_ConsentAnonymous(t *testing.T) {
+	t.Parallel()
+
+	matomoURL, hits := startHitCollector(t)
+	cfg := &Config{
+		MatomoURL: matomoURL,
+		Domains: map[string]DomainConfig{
+			"example.com": {
+				TrackingEnabled: true,
+				IdSite:          1,
+				Consent:         &ConsentConfig{Cookie: "consent", OnMissing: "anonymous"},
+				PathOverrides: map[string]PathConfig{
+					"/strict": {Consent: &ConsentConfig{Cookie: "consent"}},
+				},
+			},
+		},
+	}
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	h, err := New(context.Background(), next, cfg, "test")
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "http://example.com/page", nil)
+	req.RemoteAddr = "203.0.113.9:54321"
+	req.Header.Set("X-Forwarded-For", "198.51.100.7")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+
+	hit := expectHit(t, hits)
+	if got := hit.Header.Get("X-Forwarded-For"); got != "198.51.0.0,203.0.0.0" {
+		t.Fatalf("X-Forwarded-For = %q; want masked chain", got)
+	}
+	if got := hit.URL.Query().Get("cookie"); got != "0" {
+		t.Fatalf("cookie = %q; want 0", got)
+	}
+
+	// Consent granted: full hit
+	req = httptest.NewRequest(http.MethodGet, "http://example.com/page", nil)
+	req.RemoteAddr = "203.0.113.9:54321"
+	req.AddCookie(&http.Cookie{Name: "consent", Value: "true"})
+	h.ServeHTTP(httptest.NewRecorder(), req)
+
+	hit = expectHit(t, hits)
+	if got := hit.Header.Get("X-Forwarded-For"); got != "203.0.113.9" {
+		t.Fatalf("X-Forwarded-For = %q; want unmasked client IP", got)
+	}
+	if hit.URL.Query().Has("cookie") {
+		t.Fatalf("unexpected cookie parameter on consented hit")
+	}
+
+	// Path override requires consent and skips otherwise
+	req = httptest.NewRequest(http.MethodGet, "http://example.com/strict/page", nil)
+	req.RemoteAddr = "203.0.113.9:54321"
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	expectNoHit(t, hits)
+}
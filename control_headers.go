@@ -0,0 +1,166 @@
+package MatomoTracking
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// defaultControlHeaderPrefix is used when ControlHeadersConfig.Prefix is empty.
+const defaultControlHeaderPrefix = "X-Matomo-"
+
+// Event modes for the <prefix>Event control header.
+const (
+	eventsAlongside = "alongside" // events are sent next to the pageview (default)
+	eventsInstead   = "instead"   // events replace the pageview
+)
+
+// ControlHeadersConfig lets the upstream application drive tracking through
+// response headers. The headers are removed before the response reaches the client.
+type ControlHeadersConfig struct {
+	Enabled bool `json:"enabled,omitempty"`
+	// Prefix of the control headers. Empty = "X-Matomo-".
+	Prefix string `json:"prefix,omitempty"`
+	// Events is "alongside" (default) or "instead": whether events from
+	// <prefix>Event are sent next to the pageview or replace it.
+	Events string `json:"events,omitempty"`
+}
+
+func (c *ControlHeadersConfig) prefix() string {
+	if c.Prefix == "" {
+		return defaultControlHeaderPrefix
+	}
+	return c.Prefix
+}
+
+// applyControlHeaders applies the captured control headers to hit:
+//
+//	<prefix>Track: 0           skip tracking
+//	<prefix>Action-Name: ...   action_name
+//	<prefix>Dimension-N: ...   dimensionN
+//	<prefix>Goal: 3[;revenue=12.5]  additional goal conversion hit
+//	<prefix>Event: category=c;action=a[;name=n][;value=v]  additional event hit
+//
+// It returns false if the application asked not to track the request.
+func applyControlHeaders(captured http.Header, ch *ControlHeadersConfig, hit *trackingHit) bool {
+	if ch == nil || !ch.Enabled {
+		return true
+	}
+
+	prefix := strings.ToLower(ch.prefix())
+	for key, values := range captured {
+		if len(values) == 0 || !strings.HasPrefix(strings.ToLower(key), prefix) {
+			continue
+		}
+		name := strings.ToLower(key[len(prefix):])
+		value := strings.TrimSpace(values[0])
+		fmt.Printf("Upstream control header %s: %s\n", key, value)
+
+		switch {
+		case name == "track":
+			switch strings.ToLower(value) {
+			case "0", "false", "no", "off":
+				return false
+			}
+		case name == "action-name":
+			hit.params.Set("action_name", value)
+		case strings.HasPrefix(name, "dimension-"):
+			id, err := strconv.Atoi(strings.TrimPrefix(name, "dimension-"))
+			if err != nil || id <= 0 {
+				fmt.Println("Invalid dimension control header:", key)
+				continue
+			}
+			hit.params.Set("dimension"+strconv.Itoa(id), value)
+		case name == "goal":
+			for _, v := range values {
+				goal, err := parseGoalHeader(v)
+				if err != nil {
+					fmt.Println("Invalid goal control header:", err)
+					continue
+				}
+				hit.extra = append(hit.extra, goal)
+			}
+		case name == "event":
+			events := 0
+			for _, v := range values {
+				for _, encoded := range strings.Split(v, ",") {
+					event, err := parseEventHeader(encoded)
+					if err != nil {
+						fmt.Println("Invalid event control header:", err)
+						continue
+					}
+					hit.extra = append(hit.extra, event)
+					events++
+				}
+			}
+			if events > 0 && ch.Events == eventsInstead {
+				hit.skipMain = true
+			}
+		}
+	}
+	return true
+}
+
+// parseEventHeader parses one "category=c;action=a;name=n;value=v" event into
+// Matomo event parameters. Category and action are required; values may be
+// percent-encoded to carry ";", "," or "=".
+func parseEventHeader(value string) (url.Values, error) {
+	params := url.Values{}
+	for _, part := range strings.Split(value, ";") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		key, raw, found := strings.Cut(part, "=")
+		if !found {
+			return nil, fmt.Errorf("invalid event field %q", part)
+		}
+		val, err := url.PathUnescape(strings.TrimSpace(raw))
+		if err != nil {
+			return nil, err
+		}
+		switch strings.ToLower(strings.TrimSpace(key)) {
+		case "category":
+			params.Set("e_c", val)
+		case "action":
+			params.Set("e_a", val)
+		case "name":
+			params.Set("e_n", val)
+		case "value":
+			if _, err := strconv.ParseFloat(val, 64); err != nil {
+				return nil, fmt.Errorf("invalid event value %q", val)
+			}
+			params.Set("e_v", val)
+		default:
+			return nil, fmt.Errorf("unknown event field %q", key)
+		}
+	}
+	if params.Get("e_c") == "" || params.Get("e_a") == "" {
+		return nil, fmt.Errorf("event %q needs a category and an action", value)
+	}
+	return params, nil
+}
+
+// parseGoalHeader parses "3" or "3;revenue=12.5" into goal conversion parameters.
+func parseGoalHeader(value string) (url.Values, error) {
+	parts := strings.Split(value, ";")
+	id, err := strconv.Atoi(strings.TrimSpace(parts[0]))
+	if err != nil || id <= 0 {
+		return nil, fmt.Errorf("invalid goal ID %q", parts[0])
+	}
+
+	params := url.Values{}
+	params.Set("idgoal", strconv.Itoa(id))
+	for _, part := range parts[1:] {
+		key, val, _ := strings.Cut(strings.TrimSpace(part), "=")
+		if strings.EqualFold(key, "revenue") {
+			if _, err := strconv.ParseFloat(val, 64); err != nil {
+				return nil, fmt.Errorf("invalid goal revenue %q", val)
+			}
+			params.Set("revenue", val)
+		}
+	}
+	return params, nil
+}
@@ -0,0 +1,291 @@
+package MatomoTracking
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestApplyControlHeaders(t *testing.T) {
+	t.Parallel()
+
+	ch := &ControlHeadersConfig{Enabled: true}
+
+	captured := http.Header{}
+	captured.Set("X-Matomo-Action-Name", "Products / Detail")
+	captured.Set("X-Matomo-Dimension-3", "premium")
+	captured.Set("X-Matomo-Dimension-x", "ignored")
+	captured.Add("X-Matomo-Goal", "4;revenue=12.50")
+	captured.Add("X-Matomo-Goal", "bogus")
+
+	hit := trackingHit{params: map[string][]string{}}
+	if !applyControlHeaders(captured, ch, &hit) {
+		t.Fatalf("expected request to be tracked")
+	}
+	if got := hit.params.Get("action_name"); got != "Products / Detail" {
+		t.Fatalf("action_name = %q", got)
+	}
+	if got := hit.params.Get("dimension3"); got != "premium" {
+		t.Fatalf("dimension3 = %q", got)
+	}
+	if len(hit.params) != 2 {
+		t.Fatalf("unexpected params: %v", hit.params)
+	}
+	if len(hit.extra) != 1 || hit.extra[0].Get("idgoal") != "4" || hit.extra[0].Get("revenue") != "12.50" {
+		t.Fatalf("unexpected goal hits: %v", hit.extra)
+	}
+
+	for _, v := range []string{"0", "false", "No"} {
+		captured = http.Header{}
+		captured.Set("X-Matomo-Track", v)
+		if applyControlHeaders(captured, ch, &trackingHit{params: map[string][]string{}}) {
+			t.Fatalf("X-Matomo-Track: %s should skip tracking", v)
+		}
+	}
+
+	// Disabled config ignores the headers
+	if !applyControlHeaders(captured, &ControlHeadersConfig{}, &trackingHit{params: map[string][]string{}}) {
+		t.Fatalf("disabled control headers should not skip tracking")
+	}
+}
+
+func TestParseGoalHeader(t *testing.T) {
+	t.Parallel()
+
+	if got, err := parseGoalHeader("3"); err != nil || got.Get("idgoal") != "3" || got.Has("revenue") {
+		t.Fatalf("parseGoalHeader(3) = %v, %v", got, err)
+	}
+	if got, err := parseGoalHeader(" 3 ; Revenue=9.99"); err != nil || got.Get("revenue") != "9.99" {
+		t.Fatalf("parseGoalHeader with revenue = %v, %v", got, err)
+	}
+	for _, bad := range []string{"", "x", "0", "-1", "3;revenue=abc"} {
+		if _, err := parseGoalHeader(bad); err == nil {
+			t.Fatalf("parseGoalHeader(%q) succeeded; want error", bad)
+		}
+	}
+}
+
+func TestStatusRecorder_StripsControlHeaders(t *testing.T) {
+	t.Parallel()
+
+	for _, explicit := range []bool{true, false} {
+		rr := httptest.NewRecorder()
+		rec := newStatusRecorder(rr)
+		rec.stripPrefix = "X-Custom-"
+
+		rec.Header().Set("X-Custom-Track", "0")
+		rec.Header().Set("Content-Type", "text/plain")
+		if explicit {
+			rec.WriteHeader(http.StatusCreated)
+		}
+		_, _ = rec.Write([]byte("ok"))
+		rec.finish()
+
+		if rr.Header().Get("X-Custom-Track") != "" {
+			t.Fatalf("control header reached the client (explicit=%v)", explicit)
+		}
+		if rr.Header().Get("Content-Type") != "text/plain" {
+			t.Fatalf("regular header was stripped (explicit=%v)", explicit)
+		}
+		if rec.captured.Get("X-Custom-Track") != "0" {
+			t.Fatalf("control header not captured (explicit=%v)", explicit)
+		}
+	}
+
+	// Headers set without writing a body are captured on finish
+	rr := httptest.NewRecorder()
+	rec := newStatusRecorder(rr)
+	rec.stripPrefix = "X-Custom-"
+	rec.Header().Set("X-Custom-Action-Name", "Empty")
+	rec.finish()
+	if rr.Header().Get("X-Custom-Action-Name") != "" || rec.captured.Get("X-Custom-Action-Name") != "Empty" {
+		t.Fatalf("control header not captured on finish")
+	}
+}
+
+func TestServeHTTP_ControlHeaders(t *testing.T) {
+	t.Parallel()
+
+	matomoURL, hits := startHitCollector(t)
+	cfg := &Config{
+		MatomoURL: matomoURL,
+		Domains: map[string]DomainConfig{
+			"example.com": {
+				TrackingEnabled: true,
+				IdSite:          1,
+				ControlHeaders:  &ControlHeadersConfig{Enabled: true},
+			},
+		},
+	}
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/internal" {
+			w.Header().Set("X-Matomo-Track", "0")
+			return
+		}
+		w.Header().Set("X-Matomo-Action-Name", "Checkout / Thanks")
+		w.Header().Set("X-Matomo-Goal", "2;revenue=30")
+		_, _ = w.Write([]byte("thanks"))
+	})
+	h, err := New(context.Background(), next, cfg, "test")
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "http://example.com/checkout/thanks", nil)
+	req.RemoteAddr = "203.0.113.9:54321"
+	h.ServeHTTP(rr, req)
+
+	if rr.Header().Get("X-Matomo-Goal") != "" || rr.Header().Get("X-Matomo-Action-Name") != "" {
+		t.Fatalf("control headers reached the client: %v", rr.Header())
+	}
+
+	pageview := expectHit(t, hits).URL.Query()
+	goal := expectHit(t, hits).URL.Query()
+	if pageview.Get("action_name") != "Checkout / Thanks" || pageview.Has("idgoal") {
+		t.Fatalf("unexpected pageview params: %v", pageview)
+	}
+	if goal.Get("idgoal") != "2" || goal.Get("revenue") != "30" || goal.Has("action_name") {
+		t.Fatalf("unexpected goal params: %v", goal)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "http://example.com/internal", nil)
+	req.RemoteAddr = "203.0.113.9:54321"
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	expectNoHit(t, hits)
+}
+
+func TestParseEventHeader(t *testing.T) {
+	t.Parallel()
+
+	got, err := parseEventHeader("category=signup; action=submit;name=Newsletter%3B%20weekly;value=1.5")
+	if err != nil {
+		t.Fatalf("parseEventHeader() error = %v", err)
+	}
+	if got.Get("e_c") != "signup" || got.Get("e_a") != "submit" || got.Get("e_n") != "Newsletter; weekly" || got.Get("e_v") != "1.5" {
+		t.Fatalf("unexpected event params: %v", got)
+	}
+
+	for _, bad := range []string{"", "category=signup", "action=submit", "category=a;action=b;value=x", "category=a;action=b;color=red", "category"} {
+		if _, err := parseEventHeader(bad); err == nil {
+			t.Fatalf("parseEventHeader(%q) succeeded; want error", bad)
+		}
+	}
+}
+
+func TestApplyControlHeaders_Events(t *testing.T) {
+	t.Parallel()
+
+	captured := http.Header{}
+	captured.Add("X-Matomo-Event", "category=signup;action=submit;value=1, category=newsletter;action=subscribe")
+	captured.Add("X-Matomo-Event", "category=cart;action=add")
+	captured.Add("X-Matomo-Event", "broken")
+
+	hit := trackingHit{params: map[string][]string{}}
+	applyControlHeaders(captured, &ControlHeadersConfig{Enabled: true}, &hit)
+	if len(hit.extra) != 3 || hit.skipMain {
+		t.Fatalf("expected 3 events alongside the pageview, got %v (skipMain=%v)", hit.extra, hit.skipMain)
+	}
+
+	hit = trackingHit{params: map[string][]string{}}
+	applyControlHeaders(captured, &ControlHeadersConfig{Enabled: true, Events: "instead"}, &hit)
+	if !hit.skipMain {
+		t.Fatalf("expected events to replace the pageview")
+	}
+
+	// Without valid events the pageview is kept
+	captured = http.Header{}
+	captured.Set("X-Matomo-Event", "broken")
+	hit = trackingHit{params: map[string][]string{}}
+	applyControlHeaders(captured, &ControlHeadersConfig{Enabled: true, Events: "instead"}, &hit)
+	if hit.skipMain {
+		t.Fatalf("pageview skipped without valid events")
+	}
+}
+
+func TestTrackingHitQueries(t *testing.T) {
+	t.Parallel()
+
+	base := map[string][]string{"idsite": {"1"}, "rec": {"1"}}
+	hit := trackingHit{
+		params: map[string][]string{"action_name": {"Home"}, "dimension1": {"de"}},
+		extra:  []url.Values{{"e_c": {"cart"}, "e_a": {"add"}}},
+	}
+
+	queries := hit.queries(base)
+	if len(queries) != 2 {
+		t.Fatalf("expected 2 queries, got %d", len(queries))
+	}
+	if queries[0].Get("action_name") != "Home" || queries[0].Has("e_c") {
+		t.Fatalf("unexpected main hit: %v", queries[0])
+	}
+	if queries[1].Has("action_name") || queries[1].Get("e_c") != "cart" || queries[1].Get("dimension1") != "de" || queries[1].Get("idsite") != "1" {
+		t.Fatalf("unexpected event hit: %v", queries[1])
+	}
+
+	hit.skipMain = true
+	if queries = hit.queries(base); len(queries) != 1 || queries[0].Get("e_c") != "cart" {
+		t.Fatalf("expected only the event hit, got %v", queries)
+	}
+}
+
+func TestServeHTTP_EventsBulk(t *testing.T) {
+	t.Parallel()
+
+	matomoURL, hits := startHitCollector(t)
+	cfg := &Config{
+		MatomoURL: matomoURL,
+		Domains: map[string]DomainConfig{
+			"example.com": {
+				TrackingEnabled: true,
+				IdSite:          1,
+				ControlHeaders:  &ControlHeadersConfig{Enabled: true},
+				BulkTracking:    true,
+			},
+		},
+	}
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("X-Matomo-Event", "category=signup;action=submit")
+		w.Header().Add("X-Matomo-Event", "category=newsletter;action=subscribe")
+		w.WriteHeader(http.StatusOK)
+	})
+	h, err := New(context.Background(), next, cfg, "test")
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "http://example.com/signup", nil)
+	req.RemoteAddr = "203.0.113.9:54321"
+	h.ServeHTTP(rr, req)
+
+	if rr.Header().Get("X-Matomo-Event") != "" {
+		t.Fatalf("event header reached the client")
+	}
+
+	bulk := expectHit(t, hits)
+	if bulk.Method != http.MethodPost {
+		t.Fatalf("expected bulk POST, got %s", bulk.Method)
+	}
+	var body struct {
+		Requests []string `json:"requests"`
+	}
+	if err := json.NewDecoder(bulk.Body).Decode(&body); err != nil {
+		t.Fatalf("decoding bulk body: %v", err)
+	}
+	if len(body.Requests) != 3 {
+		t.Fatalf("expected pageview and 2 events, got %v", body.Requests)
+	}
+	event, _ := url.ParseQuery(strings.TrimPrefix(body.Requests[2], "?"))
+	if event.Get("e_c") != "newsletter" || event.Get("idsite") != "1" {
+		t.Fatalf("unexpected event request: %v", event)
+	}
+	if bulk.Header.Get("X-Forwarded-For") != "203.0.113.9" {
+		t.Fatalf("X-Forwarded-For = %q", bulk.Header.Get("X-Forwarded-For"))
+	}
+	expectNoHit(t, hits)
+}
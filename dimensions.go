@@ -0,0 +1,131 @@
+package MatomoTracking
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+// Dimension sources.
+const (
+	dimensionRequestHeader  = "requestHeader"
+	dimensionCookie         = "cookie"
+	dimensionQuery          = "query"
+	dimensionResponseHeader = "responseHeader"
+	dimensionPathCapture    = "pathCapture"
+	dimensionStatic         = "static"
+	dimensionPathOverride   = "pathOverride"
+)
+
+// DimensionConfig maps a Matomo custom dimension to the source of its value.
+type DimensionConfig struct {
+	// ID of the custom dimension in Matomo (sent as dimension<ID>).
+	ID int `json:"id,omitempty"`
+	// Source is requestHeader, cookie, query, responseHeader, pathCapture, static or pathOverride.
+	Source string `json:"source,omitempty"`
+	// Name of the header, cookie, query parameter or named capture group.
+	Name string `json:"name,omitempty"`
+	// Pattern is the path regex for pathCapture; Name selects the capture group (empty = first group).
+	Pattern string `json:"pattern,omitempty"`
+	// Value is the static value.
+	Value string `json:"value,omitempty"`
+	// MaxLength truncates the value to this many characters. 0 = no limit.
+	MaxLength int `json:"maxLength,omitempty"`
+	// AllowedValues restricts the value to this list. Other values are not sent. Empty = allow any.
+	AllowedValues []string `json:"allowedValues,omitempty"`
+}
+
+// dimensionContext holds everything a dimension value can be taken from.
+type dimensionContext struct {
+	req            *http.Request
+	responseHeader http.Header
+	captured       http.Header // response headers stripped before reaching the client
+	pathOverride   string      // key of the applied path override, if any
+}
+
+// applyDimensions resolves every configured dimension and sets it on hit.
+func applyDimensions(dc dimensionContext, dims []DimensionConfig, hit *trackingHit) {
+	for _, dim := range dims {
+		if dim.ID <= 0 {
+			fmt.Println("Invalid custom dimension ID:", dim.ID)
+			continue
+		}
+		value, ok := dimensionValue(dc, dim)
+		if !ok || value == "" {
+			continue
+		}
+		if dim.MaxLength > 0 {
+			if runes := []rune(value); len(runes) > dim.MaxLength {
+				value = string(runes[:dim.MaxLength])
+			}
+		}
+		if len(dim.AllowedValues) > 0 && !stringInList(value, dim.AllowedValues) {
+			fmt.Printf("Value for dimension %d not allowed: %q\n", dim.ID, value)
+			continue
+		}
+		hit.params.Set("dimension"+strconv.Itoa(dim.ID), value)
+	}
+}
+
+func dimensionValue(dc dimensionContext, dim DimensionConfig) (string, bool) {
+	switch dim.Source {
+	case dimensionRequestHeader:
+		return dc.req.Header.Get(dim.Name), true
+	case dimensionCookie:
+		cookie, err := dc.req.Cookie(dim.Name)
+		if err != nil {
+			return "", false
+		}
+		return cookie.Value, true
+	case dimensionQuery:
+		return dc.req.URL.Query().Get(dim.Name), true
+	case dimensionResponseHeader:
+		if v := dc.responseHeader.Get(dim.Name); v != "" {
+			return v, true
+		}
+		return dc.captured.Get(dim.Name), true
+	case dimensionPathCapture:
+		return pathCapture(dc.req.URL.Path, dim.Pattern, dim.Name)
+	case dimensionStatic:
+		return dim.Value, true
+	case dimensionPathOverride:
+		return dc.pathOverride, true
+	default:
+		fmt.Println("Unknown custom dimension source:", dim.Source)
+		return "", false
+	}
+}
+
+// pathCapture returns the named (or first) capture group of pattern in path.
+func pathCapture(path, pattern, group string) (string, bool) {
+	re, err := cachedRegexp(pattern)
+	if err != nil {
+		fmt.Println("Error compiling dimension path pattern:", err)
+		return "", false
+	}
+	match := re.FindStringSubmatch(path)
+	if match == nil {
+		return "", false
+	}
+	if group == "" {
+		if len(match) < 2 {
+			return "", false
+		}
+		return match[1], true
+	}
+	idx := re.SubexpIndex(group)
+	if idx < 0 {
+		fmt.Println("Unknown capture group in dimension path pattern:", group)
+		return "", false
+	}
+	return match[idx], true
+}
+
+func stringInList(value string, list []string) bool {
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,107 @@
+package MatomoTracking
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestApplyDimensions(t *testing.T) {
+	t.Parallel()
+
+	req := httptest.NewRequest(http.MethodGet, "http://example.com/de/products/42?ref=newsletter", nil)
+	req.Header.Set("Accept-Language", "de-DE,de;q=0.9")
+	req.AddCookie(&http.Cookie{Name: "plan", Value: "pro"})
+	dc := dimensionContext{
+		req:            req,
+		responseHeader: http.Header{"X-Category": []string{"books"}},
+		captured:       http.Header{"X-Matomo-Segment": []string{"b2b"}},
+		pathOverride:   "/de",
+	}
+	dims := []DimensionConfig{
+		{ID: 1, Source: dimensionRequestHeader, Name: "Accept-Language", MaxLength: 5},
+		{ID: 2, Source: dimensionCookie, Name: "plan", AllowedValues: []string{"free", "pro"}},
+		{ID: 3, Source: dimensionQuery, Name: "ref"},
+		{ID: 4, Source: dimensionResponseHeader, Name: "X-Category"},
+		{ID: 5, Source: dimensionResponseHeader, Name: "X-Matomo-Segment"},
+		{ID: 6, Source: dimensionPathCapture, Pattern: `^/(?P<lang>[a-z]{2})/products/(\d+)`, Name: "lang"},
+		{ID: 7, Source: dimensionPathCapture, Pattern: `^/[a-z]{2}/products/(\d+)`},
+		{ID: 8, Source: dimensionStatic, Value: "v2"},
+		{ID: 9, Source: dimensionPathOverride},
+		{ID: 10, Source: dimensionCookie, Name: "missing"},
+		{ID: 11, Source: dimensionQuery, Name: "ref", AllowedValues: []string{"ads"}},
+		{ID: 12, Source: "unknown", Name: "x"},
+		{ID: 13, Source: dimensionPathCapture, Pattern: `(`},
+		{ID: 0, Source: dimensionStatic, Value: "invalid id"},
+	}
+	hit := trackingHit{params: map[string][]string{}}
+	applyDimensions(dc, dims, &hit)
+
+	want := map[string]string{
+		"dimension1": "de-DE",
+		"dimension2": "pro",
+		"dimension3": "newsletter",
+		"dimension4": "books",
+		"dimension5": "b2b",
+		"dimension6": "de",
+		"dimension7": "42",
+		"dimension8": "v2",
+		"dimension9": "/de",
+	}
+	for k, v := range want {
+		if got := hit.params.Get(k); got != v {
+			t.Fatalf("%s = %q; want %q", k, got, v)
+		}
+	}
+	if len(hit.params) != len(want) {
+		t.Fatalf("unexpected params: %v", hit.params)
+	}
+}
+
+func TestServeHTTP_DimensionsPathOverride(t *testing.T) {
+	t.Parallel()
+
+	matomoURL, hits := startHitCollector(t)
+	cfg := &Config{
+		MatomoURL: matomoURL,
+		Domains: map[string]DomainConfig{
+			"example.com": {
+				TrackingEnabled: true,
+				IdSite:          1,
+				Dimensions: []DimensionConfig{
+					{ID: 1, Source: dimensionStatic, Value: "site"},
+				},
+				PathOverrides: map[string]PathConfig{
+					"/shop": {Dimensions: []DimensionConfig{
+						{ID: 2, Source: dimensionPathOverride},
+						{ID: 3, Source: dimensionResponseHeader, Name: "X-Category"},
+					}},
+				},
+			},
+		},
+	}
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Category", "books")
+	})
+	h, err := New(context.Background(), next, cfg, "test")
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "http://example.com/about", nil)
+	req.RemoteAddr = "203.0.113.9:54321"
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	q := expectHit(t, hits).URL.Query()
+	if q.Get("dimension1") != "site" || q.Get("dimension2") != "" {
+		t.Fatalf("unexpected domain dimensions: %v", q)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "http://example.com/shop/item", nil)
+	req.RemoteAddr = "203.0.113.9:54321"
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	q = expectHit(t, hits).URL.Query()
+	if q.Get("dimension1") != "" || q.Get("dimension2") != "/shop" || q.Get("dimension3") != "books" {
+		t.Fatalf("unexpected path dimensions: %v", q)
+	}
+}
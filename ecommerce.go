@@ -0,0 +1,140 @@
+package MatomoTracking
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// defaultEcommerceHeader is used when EcommerceConfig.Header is empty.
+const defaultEcommerceHeader = "X-Matomo-Ecommerce-Order"
+
+// EcommerceConfig enables ecommerce order tracking from a response header
+// carrying a JSON order payload. The header is removed before the response
+// reaches the client.
+type EcommerceConfig struct {
+	Enabled bool `json:"enabled,omitempty"`
+	// Header holding the order payload. Empty = "X-Matomo-Ecommerce-Order".
+	Header string `json:"header,omitempty"`
+}
+
+func (e *EcommerceConfig) header() string {
+	if e.Header == "" {
+		return defaultEcommerceHeader
+	}
+	return e.Header
+}
+
+// ecommerceOrder is the JSON payload the upstream sends for a completed order.
+type ecommerceOrder struct {
+	OrderID  string          `json:"orderId"`
+	Revenue  *float64        `json:"revenue"`
+	Subtotal *float64        `json:"subtotal"`
+	Tax      *float64        `json:"tax"`
+	Shipping *float64        `json:"shipping"`
+	Discount *float64        `json:"discount"`
+	Items    []ecommerceItem `json:"items"`
+}
+
+type ecommerceItem struct {
+	SKU      string  `json:"sku"`
+	Name     string  `json:"name"`
+	Category string  `json:"category"`
+	Price    float64 `json:"price"`
+	Quantity int     `json:"quantity"`
+}
+
+// ecommerceOrderHit builds the Matomo ecommerce order parameters from the
+// captured response headers. It returns nil if there is no valid payload.
+func ecommerceOrderHit(captured http.Header, ec *EcommerceConfig) url.Values {
+	if ec == nil || !ec.Enabled {
+		return nil
+	}
+	raw := captured.Get(ec.header())
+	if raw == "" {
+		return nil
+	}
+
+	order, err := parseEcommerceOrder(raw)
+	if err != nil {
+		fmt.Println("Invalid ecommerce order payload:", err)
+		return nil
+	}
+	fmt.Println("Ecommerce order:", order.OrderID)
+
+	params := url.Values{}
+	params.Set("idgoal", "0")
+	params.Set("ec_id", order.OrderID)
+	params.Set("revenue", formatAmount(*order.Revenue))
+	for key, amount := range map[string]*float64{
+		"ec_st": order.Subtotal,
+		"ec_tx": order.Tax,
+		"ec_sh": order.Shipping,
+		"ec_dt": order.Discount,
+	} {
+		if amount != nil {
+			params.Set(key, formatAmount(*amount))
+		}
+	}
+
+	if len(order.Items) > 0 {
+		// ec_items is a JSON array of [sku, name, category, price, quantity]
+		items := make([][]interface{}, 0, len(order.Items))
+		for _, item := range order.Items {
+			items = append(items, []interface{}{item.SKU, item.Name, item.Category, item.Price, item.Quantity})
+		}
+		encoded, err := json.Marshal(items)
+		if err != nil {
+			fmt.Println("Error encoding ecommerce items:", err)
+			return nil
+		}
+		params.Set("ec_items", string(encoded))
+	}
+	return params
+}
+
+// parseEcommerceOrder decodes and validates an order payload.
+func parseEcommerceOrder(raw string) (*ecommerceOrder, error) {
+	var order ecommerceOrder
+	dec := json.NewDecoder(bytes.NewReader([]byte(raw)))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&order); err != nil {
+		return nil, err
+	}
+
+	if order.OrderID == "" {
+		return nil, errors.New("orderId is required")
+	}
+	if order.Revenue == nil || *order.Revenue < 0 {
+		return nil, errors.New("revenue is required and must not be negative")
+	}
+	for _, amount := range []*float64{order.Subtotal, order.Tax, order.Shipping, order.Discount} {
+		if amount != nil && *amount < 0 {
+			return nil, errors.New("amounts must not be negative")
+		}
+	}
+	for i := range order.Items {
+		item := &order.Items[i]
+		if item.SKU == "" {
+			return nil, fmt.Errorf("item %d: sku is required", i)
+		}
+		if item.Price < 0 {
+			return nil, fmt.Errorf("item %d: price must not be negative", i)
+		}
+		if item.Quantity == 0 {
+			item.Quantity = 1
+		}
+		if item.Quantity < 0 {
+			return nil, fmt.Errorf("item %d: quantity must be positive", i)
+		}
+	}
+	return &order, nil
+}
+
+func formatAmount(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
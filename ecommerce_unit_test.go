@@ -0,0 +1,129 @@
+package MatomoTracking
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+const testOrderPayload = `{"orderId":"A-1001","revenue":59.9,"subtotal":50,"tax":9.5,"shipping":4.9,"discount":4.5,` +
+	`"items":[{"sku":"SKU-1","name":"Shirt","category":"Apparel","price":25,"quantity":2},{"sku":"SKU-2"}]}`
+
+func TestParseEcommerceOrder(t *testing.T) {
+	t.Parallel()
+
+	order, err := parseEcommerceOrder(testOrderPayload)
+	if err != nil {
+		t.Fatalf("parseEcommerceOrder() error = %v", err)
+	}
+	if order.OrderID != "A-1001" || *order.Revenue != 59.9 || len(order.Items) != 2 || order.Items[1].Quantity != 1 {
+		t.Fatalf("unexpected order: %+v", order)
+	}
+
+	bad := []string{
+		``,
+		`not json`,
+		`{"revenue":10}`,
+		`{"orderId":"A"}`,
+		`{"orderId":"A","revenue":-1}`,
+		`{"orderId":"A","revenue":1,"tax":-1}`,
+		`{"orderId":"A","revenue":1,"items":[{"name":"no sku"}]}`,
+		`{"orderId":"A","revenue":1,"items":[{"sku":"x","quantity":-2}]}`,
+		`{"orderId":"A","revenue":1,"total":5}`,
+	}
+	for _, payload := range bad {
+		if _, err := parseEcommerceOrder(payload); err == nil {
+			t.Fatalf("parseEcommerceOrder(%q) succeeded; want error", payload)
+		}
+	}
+}
+
+func TestEcommerceOrderHit(t *testing.T) {
+	t.Parallel()
+
+	ec := &EcommerceConfig{Enabled: true}
+	captured := http.Header{}
+	captured.Set(defaultEcommerceHeader, testOrderPayload)
+
+	params := ecommerceOrderHit(captured, ec)
+	want := map[string]string{
+		"idgoal":   "0",
+		"ec_id":    "A-1001",
+		"revenue":  "59.9",
+		"ec_st":    "50",
+		"ec_tx":    "9.5",
+		"ec_sh":    "4.9",
+		"ec_dt":    "4.5",
+		"ec_items": `[["SKU-1","Shirt","Apparel",25,2],["SKU-2","","",0,1]]`,
+	}
+	for k, v := range want {
+		if got := params.Get(k); got != v {
+			t.Fatalf("%s = %q; want %q", k, got, v)
+		}
+	}
+
+	captured.Set(defaultEcommerceHeader, `{"orderId":`)
+	if ecommerceOrderHit(captured, ec) != nil {
+		t.Fatalf("malformed payload should not produce a hit")
+	}
+	if ecommerceOrderHit(http.Header{}, ec) != nil {
+		t.Fatalf("missing payload should not produce a hit")
+	}
+	captured.Set(defaultEcommerceHeader, testOrderPayload)
+	if ecommerceOrderHit(captured, &EcommerceConfig{}) != nil {
+		t.Fatalf("disabled ecommerce should not produce a hit")
+	}
+}
+
+func TestServeHTTP_EcommerceOrder(t *testing.T) {
+	t.Parallel()
+
+	matomoURL, hits := startHitCollector(t)
+	cfg := &Config{
+		MatomoURL: matomoURL,
+		Domains: map[string]DomainConfig{
+			"example.com": {
+				TrackingEnabled: true,
+				IdSite:          1,
+				Ecommerce:       &EcommerceConfig{Enabled: true, Header: "X-Shop-Order"},
+			},
+		},
+	}
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/broken" {
+			w.Header().Set("X-Shop-Order", "{broken")
+		} else {
+			w.Header().Set("X-Shop-Order", testOrderPayload)
+		}
+		_, _ = w.Write([]byte("thank you"))
+	})
+	h, err := New(context.Background(), next, cfg, "test")
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "http://example.com/checkout/thanks", nil)
+	req.RemoteAddr = "203.0.113.9:54321"
+	h.ServeHTTP(rr, req)
+
+	if rr.Header().Get("X-Shop-Order") != "" {
+		t.Fatalf("order header reached the client")
+	}
+	expectHit(t, hits) // pageview
+	if order := expectHit(t, hits).URL.Query(); order.Get("idgoal") != "0" || order.Get("ec_id") != "A-1001" {
+		t.Fatalf("unexpected order hit: %v", order)
+	}
+
+	// Malformed payloads are dropped without breaking the response
+	rr = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodGet, "http://example.com/broken", nil)
+	req.RemoteAddr = "203.0.113.9:54321"
+	h.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK || rr.Body.String() != "thank you" || rr.Header().Get("X-Shop-Order") != "" {
+		t.Fatalf("unexpected response: %d %q %v", rr.Code, rr.Body.String(), rr.Header())
+	}
+	expectHit(t, hits) // pageview only
+	expectNoHit(t, hits)
+}
@@ -0,0 +1,53 @@
+package MatomoTracking
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// defaultErrorPageTemplate follows Matomo's convention for error page titles.
+const defaultErrorPageTemplate = "{status}/URL = {url}/From = {referrer}"
+
+// ErrorPagesConfig tracks 4xx/5xx responses with Matomo's error page titles.
+type ErrorPagesConfig struct {
+	Enabled bool `json:"enabled,omitempty"`
+	// Templates for the action name by exact status ("404") or class ("5xx").
+	// Placeholders: {status}, {url}, {path}, {referrer}. Default: "{status}/URL = {url}/From = {referrer}".
+	Templates map[string]string `json:"templates,omitempty"`
+	// IdSite sends error pages to a separate Matomo site. 0 = same site.
+	IdSite int `json:"idSite,omitempty"`
+}
+
+// applyErrorPages sets the error page title (and site) for 4xx/5xx responses.
+func applyErrorPages(req *http.Request, status int, epc *ErrorPagesConfig, hit *trackingHit) {
+	if epc == nil || !epc.Enabled || status < 400 || status > 599 {
+		return
+	}
+	template := epc.template(status)
+	// Encoded like encodeURIComponent in Matomo's JavaScript example
+	replacer := strings.NewReplacer(
+		"{status}", strconv.Itoa(status),
+		"{url}", url.PathEscape(req.URL.RequestURI()),
+		"{path}", url.PathEscape(req.URL.EscapedPath()),
+		"{referrer}", url.PathEscape(req.Referer()),
+	)
+	fmt.Println("Tracking error page:", status)
+	hit.params.Set("action_name", replacer.Replace(template))
+	if epc.IdSite > 0 {
+		hit.params.Set("idsite", strconv.Itoa(epc.IdSite))
+	}
+}
+
+// template returns the template for status: exact code, then class, then default.
+func (epc *ErrorPagesConfig) template(status int) string {
+	if t, ok := epc.Templates[strconv.Itoa(status)]; ok {
+		return t
+	}
+	if t, ok := epc.Templates[strconv.Itoa(status/100)+"xx"]; ok {
+		return t
+	}
+	return defaultErrorPageTemplate
+}
@@ -0,0 +1,87 @@
+package MatomoTracking
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestApplyErrorPages(t *testing.T) {
+	t.Parallel()
+
+	epc := &ErrorPagesConfig{
+		Enabled:   true,
+		Templates: map[string]string{"5xx": "Server error {status} at {path}", "410": "Gone: {url}"},
+		IdSite:    7,
+	}
+	cases := []struct {
+		name       string
+		epc        *ErrorPagesConfig
+		status     int
+		wantAction string
+		wantSite   string
+	}{
+		{"nil config", nil, 404, "", ""},
+		{"disabled", &ErrorPagesConfig{}, 404, "", ""},
+		{"default template", &ErrorPagesConfig{Enabled: true}, 404, "404/URL = %2Fdocs%2Fold%2520page%3Fq=1/From = https:%2F%2Fexample.org%2Flinks", ""},
+		{"class template", epc, 503, "Server error 503 at %2Fdocs%2Fold%2520page", "7"},
+		{"exact template", epc, 410, "Gone: %2Fdocs%2Fold%2520page%3Fq=1", "7"},
+		{"fallback to default", epc, 403, "403/URL = %2Fdocs%2Fold%2520page%3Fq=1/From = https:%2F%2Fexample.org%2Flinks", "7"},
+		{"success untouched", epc, 200, "", ""},
+	}
+	for _, tc := range cases {
+		req := httptest.NewRequest(http.MethodGet, "http://example.com/docs/old%20page?q=1", nil)
+		req.Header.Set("Referer", "https://example.org/links")
+		hit := trackingHit{params: map[string][]string{}}
+		applyErrorPages(req, tc.status, tc.epc, &hit)
+		if got := hit.params.Get("action_name"); got != tc.wantAction {
+			t.Fatalf("%s: action_name = %q; want %q", tc.name, got, tc.wantAction)
+		}
+		if got := hit.params.Get("idsite"); got != tc.wantSite {
+			t.Fatalf("%s: idsite = %q; want %q", tc.name, got, tc.wantSite)
+		}
+	}
+}
+
+func TestServeHTTP_ErrorPagesHonourResponseConditions(t *testing.T) {
+	t.Parallel()
+
+	matomoURL, hits := startHitCollector(t)
+	cfg := &Config{
+		MatomoURL: matomoURL,
+		Domains: map[string]DomainConfig{
+			"example.com": {
+				TrackingEnabled:    true,
+				IdSite:             1,
+				ErrorPages:         &ErrorPagesConfig{Enabled: true, IdSite: 2},
+				ResponseConditions: &ResponseConditions{NotStatusCodes: []string{"5xx"}},
+			},
+		},
+	}
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/missing":
+			w.WriteHeader(http.StatusNotFound)
+		case "/broken":
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	})
+	h, err := New(context.Background(), next, cfg, "test")
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "http://example.com/missing", nil)
+	req.RemoteAddr = "203.0.113.9:54321"
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	q := expectHit(t, hits).URL.Query()
+	if q.Get("action_name") != "404/URL = %2Fmissing/From = " || q.Get("idsite") != "2" {
+		t.Fatalf("unexpected error page params: %v", q)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "http://example.com/broken", nil)
+	req.RemoteAddr = "203.0.113.9:54321"
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	expectNoHit(t, hits)
+}
@@ -0,0 +1,94 @@
+package MatomoTracking
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// GoalConfig declares a Matomo goal conversion recorded when a request matches.
+type GoalConfig struct {
+	// ID is the Matomo goal ID (idgoal).
+	ID int `json:"id,omitempty"`
+	// Path is a regex the request path must match. Empty = any path.
+	Path string `json:"path,omitempty"`
+	// Methods the request must use. Empty = any method.
+	Methods []string `json:"methods,omitempty"`
+	// StatusCodes the final status must match ("200", "2xx", "200-299"). Empty = any status.
+	StatusCodes []string `json:"statusCodes,omitempty"`
+	// Headers are response header matchers that must all match.
+	Headers map[string]ValueMatcher `json:"headers,omitempty"`
+	// Revenue is a fixed revenue for the conversion.
+	Revenue float64 `json:"revenue,omitempty"`
+	// RevenueHeader names a response header holding the revenue; it takes precedence over Revenue.
+	RevenueHeader string `json:"revenueHeader,omitempty"`
+}
+
+// matchingGoals returns the conversion parameters of every goal matched by the
+// request and its final response.
+func matchingGoals(req *http.Request, status int, hdr http.Header, goals []GoalConfig) []url.Values {
+	var conversions []url.Values
+	for _, goal := range goals {
+		if !goalMatches(req, status, hdr, goal) {
+			continue
+		}
+		fmt.Println("Goal matched:", goal.ID)
+
+		params := url.Values{}
+		params.Set("idgoal", strconv.Itoa(goal.ID))
+		if revenue, ok := goalRevenue(hdr, goal); ok {
+			params.Set("revenue", strconv.FormatFloat(revenue, 'f', -1, 64))
+		}
+		conversions = append(conversions, params)
+	}
+	return conversions
+}
+
+func goalMatches(req *http.Request, status int, hdr http.Header, goal GoalConfig) bool {
+	if goal.ID <= 0 {
+		return false
+	}
+	if goal.Path != "" {
+		re, err := cachedRegexp(goal.Path)
+		if err != nil {
+			// Log the error and treat the goal as not matching
+			fmt.Println("Error matching regex for goal path:", err)
+			return false
+		}
+		if !re.MatchString(req.URL.Path) {
+			return false
+		}
+	}
+	if len(goal.Methods) > 0 && !methodInList(req.Method, goal.Methods) {
+		return false
+	}
+	if len(goal.StatusCodes) > 0 && !matchesAnyStatusSpec(status, goal.StatusCodes) {
+		return false
+	}
+	for k, vm := range goal.Headers {
+		if !vm.matches(hdr.Values(k)) {
+			return false
+		}
+	}
+	return true
+}
+
+// goalRevenue returns the revenue of a conversion, read from the configured
+// response header or the fixed value.
+func goalRevenue(hdr http.Header, goal GoalConfig) (float64, bool) {
+	if goal.RevenueHeader != "" {
+		if raw := strings.TrimSpace(hdr.Get(goal.RevenueHeader)); raw != "" {
+			revenue, err := strconv.ParseFloat(raw, 64)
+			if err == nil {
+				return revenue, true
+			}
+			fmt.Println("Invalid goal revenue header value:", raw)
+		}
+	}
+	if goal.Revenue != 0 {
+		return goal.Revenue, true
+	}
+	return 0, false
+}
@@ -0,0 +1,99 @@
+package MatomoTracking
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestMatchingGoals(t *testing.T) {
+	t.Parallel()
+
+	goals := []GoalConfig{
+		{ID: 3, Path: `^/checkout/thanks$`, StatusCodes: []string{"200"}, RevenueHeader: "X-Order-Total", Revenue: 1},
+		{ID: 4, Path: `^/newsletter`, Methods: []string{"POST"}, StatusCodes: []string{"2xx", "303"}},
+		{ID: 5, Headers: map[string]ValueMatcher{"X-Signup": {Present: true}}, Revenue: 2.5},
+		{ID: 0, Path: `.*`}, // invalid ID never matches
+		{ID: 6, Path: `(`},  // invalid regex never matches
+	}
+
+	cases := []struct {
+		name    string
+		method  string
+		path    string
+		status  int
+		headers map[string]string
+		want    map[string]string // idgoal -> revenue ("" = none)
+	}{
+		{"thanks with revenue header", http.MethodGet, "/checkout/thanks", 200, map[string]string{"X-Order-Total": "59.90"}, map[string]string{"3": "59.9"}},
+		{"thanks with fixed revenue", http.MethodGet, "/checkout/thanks", 200, nil, map[string]string{"3": "1"}},
+		{"thanks with invalid header", http.MethodGet, "/checkout/thanks", 200, map[string]string{"X-Order-Total": "abc"}, map[string]string{"3": "1"}},
+		{"thanks failed", http.MethodGet, "/checkout/thanks", 500, nil, map[string]string{}},
+		{"newsletter redirect", http.MethodPost, "/newsletter/subscribe", 303, nil, map[string]string{"4": ""}},
+		{"newsletter GET", http.MethodGet, "/newsletter/subscribe", 200, nil, map[string]string{}},
+		{"header goal", http.MethodGet, "/anything", 200, map[string]string{"X-Signup": "1"}, map[string]string{"5": "2.5"}},
+	}
+
+	for _, tc := range cases {
+		req := httptest.NewRequest(tc.method, "http://example.com"+tc.path, nil)
+		hdr := http.Header{}
+		for k, v := range tc.headers {
+			hdr.Set(k, v)
+		}
+		got := matchingGoals(req, tc.status, hdr, goals)
+		if len(got) != len(tc.want) {
+			t.Fatalf("%s: got %v; want %v", tc.name, got, tc.want)
+		}
+		for _, params := range got {
+			revenue, ok := tc.want[params.Get("idgoal")]
+			if !ok || params.Get("revenue") != revenue {
+				t.Fatalf("%s: unexpected conversion %v; want %v", tc.name, params, tc.want)
+			}
+		}
+	}
+}
+
+func TestServeHTTP_Goals(t *testing.T) {
+	t.Parallel()
+
+	matomoURL, hits := startHitCollector(t)
+	cfg := &Config{
+		MatomoURL: matomoURL,
+		Domains: map[string]DomainConfig{
+			"example.com": {
+				TrackingEnabled: true,
+				IdSite:          1,
+				PathOverrides: map[string]PathConfig{
+					"/checkout": {Goals: []GoalConfig{{ID: 3, Path: `/thanks$`, StatusCodes: []string{"200"}, RevenueHeader: "X-Order-Total"}}},
+				},
+			},
+		},
+	}
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Order-Total", "42.5")
+	})
+	h, err := New(context.Background(), next, cfg, "test")
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "http://example.com/checkout/thanks", nil)
+	req.RemoteAddr = "203.0.113.9:54321"
+	h.ServeHTTP(httptest.NewRecorder(), req)
+
+	if pageview := expectHit(t, hits).URL.Query(); pageview.Has("idgoal") {
+		t.Fatalf("unexpected idgoal on pageview: %v", pageview)
+	}
+	conversion := expectHit(t, hits).URL.Query()
+	if conversion.Get("idgoal") != "3" || conversion.Get("revenue") != "42.5" {
+		t.Fatalf("unexpected conversion: %v", conversion)
+	}
+
+	// Goals of a path override do not apply elsewhere
+	req = httptest.NewRequest(http.MethodGet, "http://example.com/thanks", nil)
+	req.RemoteAddr = "203.0.113.9:54321"
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	expectHit(t, hits)
+	expectNoHit(t, hits)
+}
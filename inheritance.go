@@ -0,0 +1,75 @@
+package MatomoTracking
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+// Path override inheritance modes.
+const (
+	inheritanceLongest = "longest" // only the longest matching prefix applies (default)
+	inheritanceCascade = "cascade" // every matching prefix applies, shortest first
+)
+
+// redacted replaces secrets in debug output.
+const redacted = "[redacted]"
+
+// resolvePathOverrides applies the path overrides matching path to the domain
+// config. It returns the effective config and the prefixes that contributed,
+// in the order they were applied.
+func resolvePathOverrides(domainConfig DomainConfig, path string) (DomainConfig, []string) {
+	var matching []string
+	for prefix := range domainConfig.PathOverrides {
+		if pathMatchesPrefix(path, prefix) {
+			matching = append(matching, prefix)
+		}
+	}
+	if len(matching) == 0 {
+		return domainConfig, nil
+	}
+	sort.Slice(matching, func(i, j int) bool { return len(matching[i]) < len(matching[j]) })
+
+	switch domainConfig.Inheritance {
+	case "", inheritanceLongest:
+		matching = matching[len(matching)-1:]
+	case inheritanceCascade:
+	default:
+		fmt.Println("Unknown path override inheritance, using longest match:", domainConfig.Inheritance)
+		matching = matching[len(matching)-1:]
+	}
+
+	effectiveConfig := domainConfig
+	for _, prefix := range matching {
+		fmt.Printf("Applying path override for prefix: %s\n", prefix)
+		effectiveConfig = mergeConfigs(effectiveConfig, domainConfig.PathOverrides[prefix])
+	}
+	if domainConfig.Inheritance == inheritanceCascade {
+		fmt.Println("Path override chain:", matching)
+		printEffectiveConfig(effectiveConfig)
+	}
+	return effectiveConfig, matching
+}
+
+// printEffectiveConfig logs the merged config without the path overrides
+// and with secrets redacted.
+func printEffectiveConfig(cfg DomainConfig) {
+	cfg.PathOverrides = nil
+	// Copy before redacting; the pointers are shared with the configuration
+	if cfg.AnonymizeIP != nil && cfg.AnonymizeIP.HashKey != "" {
+		anonymize := *cfg.AnonymizeIP
+		anonymize.HashKey = redacted
+		cfg.AnonymizeIP = &anonymize
+	}
+	if cfg.UserID != nil && cfg.UserID.HashKey != "" {
+		userID := *cfg.UserID
+		userID.HashKey = redacted
+		cfg.UserID = &userID
+	}
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		fmt.Println("Error encoding effective config:", err)
+		return
+	}
+	fmt.Println("Effective config:", string(data))
+}
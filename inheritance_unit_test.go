@@ -0,0 +1,123 @@
+package MatomoTracking
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestResolvePathOverrides(t *testing.T) {
+	t.Parallel()
+
+	idDocs, idAPI := 2, 3
+	disabled := false
+	dc := DomainConfig{
+		TrackingEnabled: true,
+		IdSite:          1,
+		PathOverrides: map[string]PathConfig{
+			"/docs":          {IdSite: &idDocs, ExcludedPaths: []string{`\.pdf$`}},
+			"/docs/api":      {IdSite: &idAPI},
+			"/docs/api/v1":   {TrackingEnabled: &disabled},
+			"/documentation": {IdSite: &idAPI},
+		},
+	}
+
+	// Longest match (default): /docs settings are lost below /docs/api
+	cfg, chain := resolvePathOverrides(dc, "/docs/api/users")
+	if !reflect.DeepEqual(chain, []string{"/docs/api"}) || cfg.IdSite != 3 || cfg.ExcludedPaths != nil {
+		t.Fatalf("longest: chain = %v, idSite = %d, excludedPaths = %v", chain, cfg.IdSite, cfg.ExcludedPaths)
+	}
+
+	// Cascade: every matching prefix, shortest first
+	dc.Inheritance = inheritanceCascade
+	cfg, chain = resolvePathOverrides(dc, "/docs/api/users")
+	if !reflect.DeepEqual(chain, []string{"/docs", "/docs/api"}) || cfg.IdSite != 3 || len(cfg.ExcludedPaths) != 1 {
+		t.Fatalf("cascade: chain = %v, idSite = %d, excludedPaths = %v", chain, cfg.IdSite, cfg.ExcludedPaths)
+	}
+	cfg, chain = resolvePathOverrides(dc, "/docs/api/v1/users")
+	if len(chain) != 3 || cfg.TrackingEnabled || cfg.IdSite != 3 {
+		t.Fatalf("cascade: chain = %v, trackingEnabled = %v, idSite = %d", chain, cfg.TrackingEnabled, cfg.IdSite)
+	}
+
+	// No match
+	cfg, chain = resolvePathOverrides(dc, "/blog")
+	if chain != nil || cfg.IdSite != 1 {
+		t.Fatalf("no match: chain = %v, idSite = %d", chain, cfg.IdSite)
+	}
+}
+
+func TestServeHTTP_CascadeInheritance(t *testing.T) {
+	t.Parallel()
+
+	matomoURL, hits := startHitCollector(t)
+	cfg := &Config{
+		MatomoURL: matomoURL,
+		Domains: map[string]DomainConfig{
+			"example.com": {
+				TrackingEnabled: true,
+				IdSite:          1,
+				Inheritance:     inheritanceCascade,
+				PathOverrides: map[string]PathConfig{
+					"/docs":     {ExcludedPaths: []string{`\.pdf$`}},
+					"/docs/api": {Dimensions: []DimensionConfig{{ID: 1, Source: dimensionPathOverride}}},
+				},
+			},
+		},
+	}
+	h, err := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}), cfg, "test")
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "http://example.com/docs/api/spec.pdf", nil)
+	req.RemoteAddr = "203.0.113.9:54321"
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	expectNoHit(t, hits)
+
+	req = httptest.NewRequest(http.MethodGet, "http://example.com/docs/api/users", nil)
+	req.RemoteAddr = "203.0.113.9:54321"
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	if q := expectHit(t, hits).URL.Query(); q.Get("dimension1") != "/docs/api" {
+		t.Fatalf("unexpected params: %v", q)
+	}
+}
+
+func TestPrintEffectiveConfig_RedactsSecrets(t *testing.T) {
+	cfg := DomainConfig{
+		IdSite:      1,
+		AnonymizeIP: &AnonymizeIPConfig{Mode: anonymizeHash, HashKey: "ip-secret"},
+		UserID:      &UserIDConfig{Source: userIDHeader, Name: "X-User", HashKey: "uid-secret"},
+	}
+
+	out := captureStdout(t, func() { printEffectiveConfig(cfg) })
+	if strings.Contains(out, "ip-secret") || strings.Contains(out, "uid-secret") {
+		t.Fatalf("secret in debug output: %s", out)
+	}
+	if !strings.Contains(out, redacted) || !strings.Contains(out, "X-User") {
+		t.Fatalf("unexpected debug output: %s", out)
+	}
+	if cfg.AnonymizeIP.HashKey != "ip-secret" || cfg.UserID.HashKey != "uid-secret" {
+		t.Fatalf("configuration was modified")
+	}
+}
+
+// captureStdout returns what fn prints to stdout. Tests using it must not run in parallel.
+func captureStdout(t *testing.T, fn func()) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("os.Pipe() error = %v", err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	fn()
+	os.Stdout = stdout
+	w.Close()
+	out, _ := io.ReadAll(r)
+	return string(out)
+}
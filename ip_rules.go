@@ -0,0 +1,97 @@
+package MatomoTracking
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// resolveClientIP determines the client IP of a request. The remote address
+// is used unless it belongs to a trusted proxy; in that case X-Forwarded-For
+// is walked from right to left and the first untrusted address is the client.
+func resolveClientIP(req *http.Request, trustedProxies []string) net.IP {
+	remote := req.RemoteAddr
+	if host, _, err := net.SplitHostPort(remote); err == nil {
+		remote = host
+	}
+	clientIP := net.ParseIP(remote)
+	if clientIP == nil || !ipInList(clientIP, trustedProxies) {
+		return clientIP
+	}
+
+	chain := strings.Split(req.Header.Get("X-Forwarded-For"), ",")
+	for i := len(chain) - 1; i >= 0; i-- {
+		ip := parseHostIP(chain[i]) // entries may carry a port
+		if ip == nil {
+			// Unparsable entries cannot be trusted; stop at the last valid hop
+			break
+		}
+		clientIP = ip
+		if !ipInList(ip, trustedProxies) {
+			break
+		}
+	}
+	return clientIP
+}
+
+// isIPExcluded applies excludedIPs/includedIPs to a client IP with the same
+// semantics as isPathExcluded: excluded if any excluded entry matches and no
+// included entry does.
+func isIPExcluded(ip net.IP, excludedIPs, includedIPs []string) bool {
+	if len(excludedIPs) == 0 {
+		return false
+	}
+	if ip == nil {
+		fmt.Println("Client IP unknown; IP rules not applied.")
+		return false
+	}
+
+	fmt.Println("Checking client IP:", ip)
+
+	if !ipInList(ip, excludedIPs) {
+		fmt.Println("No match found in excluded IPs; IP is not excluded.")
+		return false
+	}
+	if ipInList(ip, includedIPs) {
+		fmt.Println("Client IP matches included IPs.")
+		return false
+	}
+
+	fmt.Println("Client IP is excluded due to no matching included entry.")
+	return true
+}
+
+// ipInList reports whether ip is contained in any of the given addresses or CIDR ranges.
+func ipInList(ip net.IP, entries []string) bool {
+	for _, entry := range entries {
+		network, err := parseIPOrCIDR(entry)
+		if err != nil {
+			// Log the error and continue with the next entry
+			fmt.Println("Error parsing IP rule:", err)
+			continue
+		}
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseIPOrCIDR parses "10.0.0.0/8" style ranges as well as single addresses.
+func parseIPOrCIDR(entry string) (*net.IPNet, error) {
+	entry = strings.TrimSpace(entry)
+	if strings.Contains(entry, "/") {
+		_, network, err := net.ParseCIDR(entry)
+		return network, err
+	}
+
+	ip := net.ParseIP(entry)
+	if ip == nil {
+		return nil, fmt.Errorf("invalid IP address %q", entry)
+	}
+	if v4 := ip.To4(); v4 != nil {
+		return &net.IPNet{IP: v4, Mask: net.CIDRMask(32, 32)}, nil
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}, nil
+}
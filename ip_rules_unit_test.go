@@ -0,0 +1,125 @@
+package MatomoTracking
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestResolveClientIP(t *testing.T) {
+	t.Parallel()
+
+	trusted := []string{"10.0.0.0/8", "192.0.2.1"}
+	cases := []struct {
+		name    string
+		remote  string
+		xff     string
+		trusted []string
+		want    string
+	}{
+		{"no trusted proxies", "10.0.0.5:1234", "203.0.113.9", nil, "10.0.0.5"},
+		{"untrusted remote ignores XFF", "198.51.100.7:1234", "203.0.113.9", trusted, "198.51.100.7"},
+		{"trusted remote uses XFF", "10.0.0.5:1234", "203.0.113.9", trusted, "203.0.113.9"},
+		{"skips trusted hops", "10.0.0.5:1234", "203.0.113.9, 198.51.100.7, 192.0.2.1", trusted, "198.51.100.7"},
+		{"all trusted uses leftmost", "10.0.0.5:1234", "10.1.1.1, 192.0.2.1", trusted, "10.1.1.1"},
+		{"garbage stops walk", "10.0.0.5:1234", "203.0.113.9, unknown, 10.2.2.2", trusted, "10.2.2.2"},
+		{"XFF entry with port", "10.0.0.1:1234", "198.51.100.7:4711", trusted, "198.51.100.7"},
+		{"XFF IPv6 entry with port", "10.0.0.1:1234", "[2001:db8::7]:443, 192.0.2.1", trusted, "2001:db8::7"},
+		{"no XFF", "10.0.0.5:1234", "", trusted, "10.0.0.5"},
+		{"IPv6", "[2001:db8::1]:1234", "", nil, "2001:db8::1"},
+	}
+
+	for _, tc := range cases {
+		req := httptest.NewRequest(http.MethodGet, "http://example.com/", nil)
+		req.RemoteAddr = tc.remote
+		if tc.xff != "" {
+			req.Header.Set("X-Forwarded-For", tc.xff)
+		}
+		got := resolveClientIP(req, tc.trusted)
+		if !got.Equal(net.ParseIP(tc.want)) {
+			t.Fatalf("%s: resolveClientIP() = %v; want %s", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestIsIPExcluded(t *testing.T) {
+	t.Parallel()
+
+	excluded := []string{"10.0.0.0/8", "203.0.113.9", "2001:db8::/32", "not-an-ip"}
+	included := []string{"10.1.0.0/16"}
+
+	cases := []struct {
+		ip   string
+		want bool
+	}{
+		{"10.2.3.4", true},       // excluded range
+		{"10.1.3.4", false},      // included explicitly
+		{"203.0.113.9", true},    // excluded single address
+		{"203.0.113.10", false},  // no excluded match
+		{"2001:db8::abcd", true}, // excluded IPv6 range
+		{"2001:db9::1", false},   // no excluded match
+	}
+	for _, tc := range cases {
+		if got := isIPExcluded(net.ParseIP(tc.ip), excluded, included); got != tc.want {
+			t.Fatalf("isIPExcluded(%s) = %v; want %v", tc.ip, got, tc.want)
+		}
+	}
+
+	if isIPExcluded(nil, excluded, included) {
+		t.Fatalf("unknown IP should not be excluded")
+	}
+	if isIPExcluded(net.ParseIP("10.2.3.4"), nil, nil) {
+		t.Fatalf("no rules should not exclude")
+	}
+}
+
+func TestMergeConfigs_IPLists(t *testing.T) {
+	t.Parallel()
+
+	base := DomainConfig{ExcludedIPs: []string{"10.0.0.0/8"}, IncludedIPs: []string{"10.1.0.0/16"}}
+
+	got := mergeConfigs(base, PathConfig{ExcludedIPs: []string{"192.0.2.0/24"}})
+	if len(got.ExcludedIPs) != 1 || got.ExcludedIPs[0] != "192.0.2.0/24" {
+		t.Fatalf("ExcludedIPs = %#v; want override", got.ExcludedIPs)
+	}
+	if len(got.IncludedIPs) != 1 || got.IncludedIPs[0] != "10.1.0.0/16" {
+		t.Fatalf("IncludedIPs = %#v; want inherited", got.IncludedIPs)
+	}
+}
+
+func TestServeHTTP_ExcludedIPs(t *testing.T) {
+	t.Parallel()
+
+	matomoURL, hits := startHitCollector(t)
+	cfg := &Config{
+		MatomoURL:      matomoURL,
+		TrustedProxies: []string{"10.0.0.0/8"},
+		Domains: map[string]DomainConfig{
+			"example.com": {
+				TrackingEnabled: true,
+				IdSite:          1,
+				ExcludedIPs:     []string{"198.51.100.0/24"},
+			},
+		},
+	}
+	h, err := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}), cfg, "test")
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	// Office network behind the trusted proxy
+	req := httptest.NewRequest(http.MethodGet, "http://example.com/page", nil)
+	req.RemoteAddr = "10.0.0.5:1234"
+	req.Header.Set("X-Forwarded-For", "198.51.100.7")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	expectNoHit(t, hits)
+
+	// Spoofed XFF from an untrusted client is ignored
+	req = httptest.NewRequest(http.MethodGet, "http://example.com/page", nil)
+	req.RemoteAddr = "203.0.113.9:1234"
+	req.Header.Set("X-Forwarded-For", "198.51.100.7")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	expectHit(t, hits)
+}
@@ -0,0 +1,93 @@
+package MatomoTracking
+
+// mergeStringList returns list without the entries in remove and with the
+// entries in add that it does not contain yet. list itself is not modified.
+func mergeStringList(list, add, remove []string) []string {
+	if add == nil && remove == nil {
+		return list
+	}
+	merged := make([]string, 0, len(list)+len(add))
+	for _, v := range list {
+		if !stringInList(v, remove) {
+			merged = append(merged, v)
+		}
+	}
+	for _, v := range add {
+		if !stringInList(v, merged) {
+			merged = append(merged, v)
+		}
+	}
+	return merged
+}
+
+// mergeGoals removes goals by ID and appends goals, replacing any goal with
+// the same ID. goals itself is not modified.
+func mergeGoals(goals, add []GoalConfig, remove []int) []GoalConfig {
+	if add == nil && remove == nil {
+		return goals
+	}
+	merged := make([]GoalConfig, 0, len(goals)+len(add))
+	for _, g := range goals {
+		if !intInList(g.ID, remove) && !goalInList(g.ID, add) {
+			merged = append(merged, g)
+		}
+	}
+	return append(merged, add...)
+}
+
+// mergeDimensions removes dimensions by ID and appends dimensions, replacing
+// any dimension with the same ID. dims itself is not modified.
+func mergeDimensions(dims, add []DimensionConfig, remove []int) []DimensionConfig {
+	if add == nil && remove == nil {
+		return dims
+	}
+	merged := make([]DimensionConfig, 0, len(dims)+len(add))
+	for _, d := range dims {
+		if !intInList(d.ID, remove) && !dimensionInList(d.ID, add) {
+			merged = append(merged, d)
+		}
+	}
+	return append(merged, add...)
+}
+
+// mergeIntList returns list with the entries of add that it does not contain
+// yet. list itself is not modified.
+func mergeIntList(list, add []int) []int {
+	if add == nil {
+		return list
+	}
+	merged := append([]int(nil), list...)
+	for _, v := range add {
+		if !intInList(v, merged) {
+			merged = append(merged, v)
+		}
+	}
+	return merged
+}
+
+func goalInList(id int, goals []GoalConfig) bool {
+	for _, g := range goals {
+		if g.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+func dimensionInList(id int, dims []DimensionConfig) bool {
+	for _, d := range dims {
+		if d.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+func intInList(value int, list []int) bool {
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
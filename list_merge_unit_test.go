@@ -0,0 +1,77 @@
+package MatomoTracking
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMergeStringList(t *testing.T) {
+	t.Parallel()
+
+	base := []string{`\.php$`, `^/admin`}
+	cases := []struct {
+		name   string
+		add    []string
+		remove []string
+		want   []string
+	}{
+		{"no modifiers", nil, nil, []string{`\.php$`, `^/admin`}},
+		{"append", []string{`\.pdf$`}, nil, []string{`\.php$`, `^/admin`, `\.pdf$`}},
+		{"append existing", []string{`^/admin`}, nil, []string{`\.php$`, `^/admin`}},
+		{"remove", nil, []string{`^/admin`, `^/unknown`}, []string{`\.php$`}},
+		{"remove and append", []string{`\.pdf$`}, []string{`\.php$`}, []string{`^/admin`, `\.pdf$`}},
+	}
+	for _, tc := range cases {
+		if got := mergeStringList(base, tc.add, tc.remove); !reflect.DeepEqual(got, tc.want) {
+			t.Fatalf("%s: got %v; want %v", tc.name, got, tc.want)
+		}
+	}
+	if !reflect.DeepEqual(base, []string{`\.php$`, `^/admin`}) {
+		t.Fatalf("base list was modified: %v", base)
+	}
+}
+
+func TestMergeConfigs_ListModifiers(t *testing.T) {
+	t.Parallel()
+
+	base := DomainConfig{
+		ExcludedPaths: []string{`\.php$`},
+		ExcludedIPs:   []string{"10.0.0.0/8", "192.168.0.0/16"},
+		Goals:         []GoalConfig{{ID: 1, Path: "^/a"}, {ID: 2, Path: "^/b"}},
+		Dimensions:    []DimensionConfig{{ID: 1, Source: dimensionStatic, Value: "x"}, {ID: 2, Source: dimensionPathOverride}},
+	}
+	override := PathConfig{
+		IncludedPaths:       []string{`^/subdir/keep`},
+		ExcludedPathsAppend: []string{`^/subdir/private`},
+		IncludedPathsAppend: []string{`^/subdir/also`},
+		ExcludedIPsRemove:   []string{"192.168.0.0/16"},
+		IncludedIPsAppend:   []string{"10.1.0.0/16"},
+		GoalsAppend:         []GoalConfig{{ID: 2, Path: "^/subdir/b"}, {ID: 3}},
+		GoalsRemove:         []int{1},
+		DimensionsAppend:    []DimensionConfig{{ID: 1, Source: dimensionStatic, Value: "y"}},
+		DimensionsRemove:    []int{2},
+	}
+	merged := mergeConfigs(base, override)
+
+	if want := []string{`\.php$`, `^/subdir/private`}; !reflect.DeepEqual(merged.ExcludedPaths, want) {
+		t.Fatalf("ExcludedPaths = %v; want %v", merged.ExcludedPaths, want)
+	}
+	if want := []string{`^/subdir/keep`, `^/subdir/also`}; !reflect.DeepEqual(merged.IncludedPaths, want) {
+		t.Fatalf("IncludedPaths = %v; want %v", merged.IncludedPaths, want)
+	}
+	if want := []string{"10.0.0.0/8"}; !reflect.DeepEqual(merged.ExcludedIPs, want) {
+		t.Fatalf("ExcludedIPs = %v; want %v", merged.ExcludedIPs, want)
+	}
+	if want := []string{"10.1.0.0/16"}; !reflect.DeepEqual(merged.IncludedIPs, want) {
+		t.Fatalf("IncludedIPs = %v; want %v", merged.IncludedIPs, want)
+	}
+	if want := []GoalConfig{{ID: 2, Path: "^/subdir/b"}, {ID: 3}}; !reflect.DeepEqual(merged.Goals, want) {
+		t.Fatalf("Goals = %v; want %v", merged.Goals, want)
+	}
+	if want := []DimensionConfig{{ID: 1, Source: dimensionStatic, Value: "y"}}; !reflect.DeepEqual(merged.Dimensions, want) {
+		t.Fatalf("Dimensions = %v; want %v", merged.Dimensions, want)
+	}
+	if len(base.ExcludedPaths) != 1 || len(base.Goals) != 2 || base.Dimensions[0].Value != "x" {
+		t.Fatalf("base config was modified: %+v", base)
+	}
+}
@@ -1,24 +1,63 @@
 package MatomoTracking
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
 	"net"
 	"net/http"
 	"net/url"
+	"reflect"
 	"regexp"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
 // PathConfig specifies the tracking rules for a specific path.
 type PathConfig struct {
-	TrackingEnabled    *bool               `json:"trackingEnabled,omitempty"`
-	IdSite             *int                `json:"idSite,omitempty"`
-	ExcludedPaths      []string            `json:"excludedPaths,omitempty"`
-	IncludedPaths      []string            `json:"includedPaths,omitempty"`
-	ResponseConditions *ResponseConditions `json:"responseConditions,omitempty"`
+	TrackingEnabled    *bool                 `json:"trackingEnabled,omitempty"`
+	IdSite             *int                  `json:"idSite,omitempty"`
+	ExcludedPaths      []string              `json:"excludedPaths,omitempty"`
+	IncludedPaths      []string              `json:"includedPaths,omitempty"`
+	ResponseConditions *ResponseConditions   `json:"responseConditions,omitempty"`
+	Consent            *ConsentConfig        `json:"consent,omitempty"`
+	AnonymizeIP        *AnonymizeIPConfig    `json:"anonymizeIP,omitempty"`
+	ExcludedIPs        []string              `json:"excludedIPs,omitempty"`
+	IncludedIPs        []string              `json:"includedIPs,omitempty"`
+	Bots               *BotConfig            `json:"bots,omitempty"`
+	RequestKinds       *RequestKindsConfig   `json:"requestKinds,omitempty"`
+	Methods            *MethodsConfig        `json:"methods,omitempty"`
+	RequestConditions  *RequestConditions    `json:"requestConditions,omitempty"`
+	ControlHeaders     *ControlHeadersConfig `json:"controlHeaders,omitempty"`
+	BulkTracking       *bool                 `json:"bulkTracking,omitempty"`
+	Goals              []GoalConfig          `json:"goals,omitempty"`
+	Ecommerce          *EcommerceConfig      `json:"ecommerce,omitempty"`
+	Dimensions         []DimensionConfig     `json:"dimensions,omitempty"`
+	UserID             *UserIDConfig         `json:"userId,omitempty"`
+	UpgradeTracking    *string               `json:"upgradeTracking,omitempty"`
+	TrackAt            *string               `json:"trackAt,omitempty"`
+	AbortedEvents      *bool                 `json:"abortedEvents,omitempty"`
+	ErrorPages         *ErrorPagesConfig     `json:"errorPages,omitempty"`
+	Rewrite            []RewriteRule         `json:"rewrite,omitempty"`
+	MatomoURL          *string               `json:"matomoURL,omitempty"`
+	PathOverrides      map[string]PathConfig `json:"paths,omitempty"` // nested, relative to this prefix
+
+	// List modifiers, applied after the plain fields above
+	ExcludedPathsAppend []string          `json:"excludedPathsAppend,omitempty"`
+	ExcludedPathsRemove []string          `json:"excludedPathsRemove,omitempty"`
+	IncludedPathsAppend []string          `json:"includedPathsAppend,omitempty"`
+	IncludedPathsRemove []string          `json:"includedPathsRemove,omitempty"`
+	ExcludedIPsAppend   []string          `json:"excludedIPsAppend,omitempty"`
+	ExcludedIPsRemove   []string          `json:"excludedIPsRemove,omitempty"`
+	IncludedIPsAppend   []string          `json:"includedIPsAppend,omitempty"`
+	IncludedIPsRemove   []string          `json:"includedIPsRemove,omitempty"`
+	GoalsAppend         []GoalConfig      `json:"goalsAppend,omitempty"`      // replaces goals with the same ID
+	GoalsRemove         []int             `json:"goalsRemove,omitempty"`      // goal IDs
+	DimensionsAppend    []DimensionConfig `json:"dimensionsAppend,omitempty"` // replaces dimensions with the same ID
+	DimensionsRemove    []int             `json:"dimensionsRemove,omitempty"` // dimension IDs
 }
 
 // DomainConfig specifies the tracking rules for a specific domain.
@@ -29,12 +68,35 @@ type DomainConfig struct {
 	IncludedPaths      []string              `json:"includedPaths,omitempty"`
 	PathOverrides      map[string]PathConfig `json:"paths,omitempty"`
 	ResponseConditions *ResponseConditions   `json:"responseConditions,omitempty"`
+	Consent            *ConsentConfig        `json:"consent,omitempty"`
+	AnonymizeIP        *AnonymizeIPConfig    `json:"anonymizeIP,omitempty"`
+	ExcludedIPs        []string              `json:"excludedIPs,omitempty"`
+	IncludedIPs        []string              `json:"includedIPs,omitempty"`
+	Bots               *BotConfig            `json:"bots,omitempty"`
+	RequestKinds       *RequestKindsConfig   `json:"requestKinds,omitempty"`
+	Methods            *MethodsConfig        `json:"methods,omitempty"`
+	RequestConditions  *RequestConditions    `json:"requestConditions,omitempty"`
+	ControlHeaders     *ControlHeadersConfig `json:"controlHeaders,omitempty"`
+	BulkTracking       bool                  `json:"bulkTracking,omitempty"`
+	Goals              []GoalConfig          `json:"goals,omitempty"`
+	Ecommerce          *EcommerceConfig      `json:"ecommerce,omitempty"`
+	Dimensions         []DimensionConfig     `json:"dimensions,omitempty"`
+	UserID             *UserIDConfig         `json:"userId,omitempty"`
+	UpgradeTracking    string                `json:"upgradeTracking,omitempty"` // skip (default), pageview or event
+	TrackAt            string                `json:"trackAt,omitempty"`         // completion (default) or headers
+	AbortedEvents      bool                  `json:"abortedEvents,omitempty"`   // record aborted responses as events
+	ErrorPages         *ErrorPagesConfig     `json:"errorPages,omitempty"`
+	Rewrite            []RewriteRule         `json:"rewrite,omitempty"`
+	Inheritance        string                `json:"inheritance,omitempty"` // longest (default) or cascade
+	MatomoURL          string                `json:"matomoURL,omitempty"`   // empty = Config.MatomoURL
 }
 
 // Config represents the configuration for the MatomoTracking plugin.
 type Config struct {
-	MatomoURL string                  `json:"matomoURL,omitempty"`
-	Domains   map[string]DomainConfig `json:"domains,omitempty"`
+	MatomoURL      string                  `json:"matomoURL,omitempty"`
+	Domains        map[string]DomainConfig `json:"domains,omitempty"`
+	TrustedProxies []string                `json:"trustedProxies,omitempty"`
+	BotSignatures  []BotSignature          `json:"botSignatures,omitempty"`
 }
 
 // CreateConfig returns the default configuration for the plugin.
@@ -45,19 +107,85 @@ func CreateConfig() *Config {
 	}
 }
 
+// trackingHit carries the request-scoped decisions that shape the hit sent to Matomo.
+type trackingHit struct {
+	params     url.Values   // Matomo tracking API parameters that override the defaults
+	extra      []url.Values // additional hits sent alongside the main hit (e.g. goal conversions)
+	skipMain   bool         // send only the additional hits
+	anonymous  bool         // anonymize client IPs and omit visitor identifiers
+	cookieless bool         // omit visitor identifiers
+}
+
+// mainHitOnlyParams describe the main hit and are not copied to additional hits.
+var mainHitOnlyParams = []string{"action_name", "e_c", "e_a", "e_n", "e_v", "pf_srv", "pf_tfr", "bw_bytes"}
+
+// queries returns the Matomo query of every hit, starting with the main hit
+// unless it is skipped.
+func (h *trackingHit) queries(base url.Values) []url.Values {
+	main := cloneValues(base)
+	for key, values := range h.params {
+		main[key] = values
+	}
+	var queries []url.Values
+	if !h.skipMain || len(h.extra) == 0 {
+		queries = append(queries, main)
+	}
+
+	for _, extra := range h.extra {
+		q := cloneValues(main)
+		for _, key := range mainHitOnlyParams {
+			q.Del(key)
+		}
+		for key, values := range extra {
+			q[key] = values
+		}
+		queries = append(queries, q)
+	}
+	return queries
+}
+
+func cloneValues(v url.Values) url.Values {
+	clone := make(url.Values, len(v))
+	for key, values := range v {
+		clone[key] = append([]string(nil), values...)
+	}
+	return clone
+}
+
+// setEvent turns the hit into a Matomo event instead of a pageview.
+func (h *trackingHit) setEvent(category, action, name string) {
+	h.params.Set("e_c", category)
+	h.params.Set("e_a", action)
+	if name != "" {
+		h.params.Set("e_n", name)
+	}
+}
+
 // MatomoTracking is the middleware that handles Matomo tracking.
 type MatomoTracking struct {
-	next   http.Handler
-	name   string
-	config *Config
+	next        http.Handler
+	name        string
+	config      *Config
+	botMatchers []botMatcher // compiled Config.BotSignatures
 }
 
 // New creates a new instance of the MatomoTracking middleware.
 func New(ctx context.Context, next http.Handler, config *Config, name string) (http.Handler, error) {
+	// Resolve nested path overrides once, without modifying the caller's config
+	cfg := *config
+	cfg.Domains = make(map[string]DomainConfig, len(config.Domains))
+	for domain, domainConfig := range config.Domains {
+		if domainConfig.PathOverrides != nil {
+			domainConfig.PathOverrides = flattenPathOverrides(domainConfig.PathOverrides)
+		}
+		cfg.Domains[domain] = domainConfig
+	}
+
 	return &MatomoTracking{
-		next:   next,
-		name:   name,
-		config: config,
+		next:        next,
+		name:        name,
+		config:      &cfg,
+		botMatchers: compileBotSignatures(config.BotSignatures),
 	}, nil
 }
 
@@ -97,46 +225,114 @@ func (m *MatomoTracking) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	// Start with the base (domain-level) config
-	effectiveConfig := domainConfig
 	requestPath := req.URL.Path
 
-	// Look for the best matching path override (longest prefix match)
-	if domainConfig.PathOverrides != nil {
-		var bestMatch string
-		for prefix := range domainConfig.PathOverrides {
-			if pathMatchesPrefix(requestPath, prefix) && len(prefix) > len(bestMatch) {
-				bestMatch = prefix
-			}
-		}
+	// Apply matching path overrides (longest prefix, or every prefix in cascade mode)
+	var bestMatch string
+	effectiveConfig, chain := resolvePathOverrides(domainConfig, requestPath)
+	if len(chain) > 0 {
+		bestMatch = chain[len(chain)-1]
+	}
 
-		// Apply path-level override if found
-		if bestMatch != "" {
-			override := domainConfig.PathOverrides[bestMatch]
-			fmt.Printf("Applying path override for prefix: %s\n", bestMatch)
-			effectiveConfig = mergeConfigs(domainConfig, override)
-		}
+	// Evaluate request-side rules before the request is handed on
+	clientIP := resolveClientIP(req, m.config.TrustedProxies)
+	consent := consentMode(req, effectiveConfig.Consent)
+	hit := trackingHit{
+		params:     url.Values{},
+		anonymous:  consent == consentAnonymous,
+		cookieless: consent == consentAnonymous || consent == consentCookieless,
 	}
+	botAllowed := applyBotHandling(req, effectiveConfig.Bots, m.botMatchers, &hit)
+	kindAllowed := applyRequestKinds(req, effectiveConfig.RequestKinds, &hit)
+	methodAllowed := applyMethods(req, effectiveConfig.Methods, &hit)
+	requestMatched := matchesRequestConditions(req, effectiveConfig.RequestConditions)
+	requestAllowed := botAllowed && kindAllowed && methodAllowed && requestMatched
+	applyUserID(req, effectiveConfig.UserID, &hit)
 
 	// Invoke next and capture final status/headers
 	rec := newStatusRecorder(rw)
+	if ch := effectiveConfig.ControlHeaders; ch != nil && ch.Enabled {
+		rec.stripPrefix = ch.prefix()
+	}
+	if ec := effectiveConfig.Ecommerce; ec != nil && ec.Enabled {
+		rec.stripNames = append(rec.stripNames, ec.header())
+	}
+	// Decide whether to track once, either when the final header is written
+	// (trackAt: headers) or when the handler has returned
+	var decided sync.Once
+	decide := func() {
+		decided.Do(func() {
+			m.trackResponse(req, rec, effectiveConfig, requestedDomain, bestMatch, requestPath, clientIP, consent, requestAllowed, hit)
+		})
+	}
+	if effectiveConfig.TrackAt == trackAtHeaders {
+		rec.onHeader = decide
+	}
+	// A panicking handler is only tracked on opt-in (abortedEvents or an
+	// onlyCompleted condition); re-panic for Traefik's recovery either way
+	defer func() {
+		if p := recover(); p != nil {
+			rec.abort(panicReason(p))
+			if !rec.wroteHeader {
+				// Traefik's recovery answers with 500
+				rec.status = http.StatusInternalServerError
+			}
+			if effectiveConfig.AbortedEvents || usesOnlyCompleted(effectiveConfig.ResponseConditions) {
+				rec.finish()
+				decide()
+			} else {
+				fmt.Println("Handler panicked; tracking skipped.")
+			}
+			panic(p)
+		}
+	}()
 	m.next.ServeHTTP(rec, req)
+	if req.Context().Err() != nil && !rec.hijacked {
+		rec.abort(abortDisconnected)
+	}
+	rec.finish()
+	decide()
+}
+
+// trackResponse evaluates the response-side rules and sends the hit if the
+// request is to be tracked.
+func (m *MatomoTracking) trackResponse(req *http.Request, rec *statusRecorder, effectiveConfig DomainConfig, requestedDomain, bestMatch, requestPath string, clientIP net.IP, consent string, requestAllowed bool, hit trackingHit) {
+	applyPerformance(rec, &hit)
+	applyAborted(req, rec, effectiveConfig.AbortedEvents, &hit)
+	upgradeAllowed := applyUpgradeTracking(req, rec, effectiveConfig.UpgradeTracking, &hit)
+	applyDimensions(dimensionContext{
+		req:            req,
+		responseHeader: rec.Header(),
+		captured:       rec.captured,
+		pathOverride:   bestMatch,
+	}, effectiveConfig.Dimensions, &hit)
+	applyErrorPages(req, rec.status, effectiveConfig.ErrorPages, &hit)
+	controlAllowed := applyControlHeaders(rec.captured, effectiveConfig.ControlHeaders, &hit)
 
 	// Decide post-response whether to track
 	shouldTrack := effectiveConfig.TrackingEnabled &&
+		consent != consentSkip &&
+		requestAllowed &&
+		controlAllowed &&
+		upgradeAllowed &&
 		!isPathExcluded(requestPath, effectiveConfig.ExcludedPaths, effectiveConfig.IncludedPaths) &&
-		matchesResponseConditions(rec.status, rec.Header(), effectiveConfig.ResponseConditions)
+		!isIPExcluded(clientIP, effectiveConfig.ExcludedIPs, effectiveConfig.IncludedIPs) &&
+		matchesResponseConditions(rec.status, rec.Header(), rec.abortReason == "", effectiveConfig.ResponseConditions)
 
 	if shouldTrack {
 		fmt.Println("Tracking the request...")
-		go m.sendTrackingRequest(req, effectiveConfig, requestedDomain)
+		hit.extra = append(hit.extra, matchingGoals(req, rec.status, rec.Header(), effectiveConfig.Goals)...)
+		if order := ecommerceOrderHit(rec.captured, effectiveConfig.Ecommerce); order != nil {
+			hit.extra = append(hit.extra, order)
+		}
+		go m.sendTrackingRequest(req, effectiveConfig, requestedDomain, hit)
 	} else {
-		fmt.Println("Tracking skipped (disabled, excluded, or response conditions not met).")
+		fmt.Println("Tracking skipped (disabled, no consent, bot, request kind or method, excluded path or IP, upstream control header, upgraded connection, or request/response conditions not met).")
 	}
 }
 
 // sendTrackingRequest sends a tracking request to Matomo asynchronously.
-func (m *MatomoTracking) sendTrackingRequest(req *http.Request, domainConfig DomainConfig, requestedDomain string) {
+func (m *MatomoTracking) sendTrackingRequest(req *http.Request, domainConfig DomainConfig, requestedDomain string, hit trackingHit) {
 	// Get IP address of requesting client/proxy
 	clientIP, _, err := net.SplitHostPort(req.RemoteAddr)
 	if err != nil {
@@ -148,7 +344,11 @@ func (m *MatomoTracking) sendTrackingRequest(req *http.Request, domainConfig Dom
 	fmt.Println("Client Remote Address: ", req.RemoteAddr)
 
 	// Build the Matomo URL
-	matomoReqURL, err := url.Parse(m.config.MatomoURL)
+	matomoURL := domainConfig.MatomoURL
+	if matomoURL == "" {
+		matomoURL = m.config.MatomoURL
+	}
+	matomoReqURL, err := url.Parse(matomoURL)
 	if err != nil {
 		fmt.Println("Error parsing Matomo URL:", err)
 		return
@@ -161,8 +361,9 @@ func (m *MatomoTracking) sendTrackingRequest(req *http.Request, domainConfig Dom
 		fmt.Println("Error parsing URI:", err)
 		return
 	}
-	// Convert the path to lowercase
-	parsedURI.Path = strings.ToLower(parsedURI.Path)
+	// Apply rewrite rules, then convert the path to lowercase
+	rewrittenPath, actionName := rewritePath(req.URL.Path, domainConfig.Rewrite)
+	parsedURI.Path = strings.ToLower(rewrittenPath)
 
 	// Reconstruct the URI with the lowercase path
 	requestURI = parsedURI.String()
@@ -179,30 +380,95 @@ func (m *MatomoTracking) sendTrackingRequest(req *http.Request, domainConfig Dom
 	query.Set("url", fullURL)
 	query.Set("rec", "1")
 	query.Set("idsite", strconv.Itoa(domainConfig.IdSite))
-	matomoReqURL.RawQuery = query.Encode()
-	fmt.Println("Matomo query string:", matomoReqURL.RawQuery)
-
-	// Create the Matomo request
-	matomoReq, err := http.NewRequest("GET", matomoReqURL.String(), nil)
-	if err != nil {
-		fmt.Println("Error creating Matomo request:", err)
-		return
+	if actionName != "" {
+		// Action names from the hit (control headers, error pages) take precedence
+		query.Set("action_name", actionName)
+	}
+	if hit.cookieless {
+		// Tell Matomo the visitor did not accept cookies
+		query.Set("cookie", "0")
 	}
 
 	// Set matomo request headers
-	matomoReq.Header.Set("User-Agent", req.Header.Get("User-Agent"))
+	header := http.Header{}
+	header.Set("User-Agent", req.Header.Get("User-Agent"))
 
 	// Set or append to the X-Forwarded-For header to preserve the client IP chain for Matomo tracking.
 	// The first entry is the original client ip
 	// The last entry is the ip of the last/previous client/proxy in the chain
 	// Matomo should be configured to use the first entry in the X-Forwarded-For header for tracking
+	xff := clientIP
 	if existingXFF := req.Header.Get("X-Forwarded-For"); existingXFF != "" {
 		fmt.Println("Existing XFF: ", existingXFF)
-		matomoReq.Header.Set("X-Forwarded-For", existingXFF+","+clientIP)
-	} else {
-		matomoReq.Header.Set("X-Forwarded-For", clientIP)
+		xff = existingXFF + "," + clientIP
+	}
+
+	// Anonymize every address in the chain before it leaves the proxy.
+	// Missing consent forces anonymization even if the domain does not configure it.
+	anonymize := domainConfig.AnonymizeIP
+	if hit.anonymous && anonymize == nil {
+		anonymize = defaultAnonymizeIP
+	}
+	if anonymize != nil {
+		xff = anonymizeForwardedFor(xff, anonymize)
+	}
+	header.Set("X-Forwarded-For", xff)
+
+	queries := hit.queries(query)
+	if domainConfig.BulkTracking && len(queries) > 1 {
+		m.sendBulkRequest(matomoReqURL, queries, header)
+		return
+	}
+	for _, q := range queries {
+		m.sendMatomoRequest(matomoReqURL, q, header)
+	}
+}
+
+// sendBulkRequest sends several hits in one Matomo bulk tracking request.
+func (m *MatomoTracking) sendBulkRequest(matomoURL *url.URL, queries []url.Values, header http.Header) {
+	bulk := struct {
+		Requests []string `json:"requests"`
+	}{}
+	for _, q := range queries {
+		bulk.Requests = append(bulk.Requests, "?"+q.Encode())
+	}
+	body, err := json.Marshal(bulk)
+	if err != nil {
+		fmt.Println("Error encoding Matomo bulk request:", err)
+		return
+	}
+	fmt.Println("Matomo bulk request:", string(body))
+
+	matomoReq, err := http.NewRequest("POST", matomoURL.String(), bytes.NewReader(body))
+	if err != nil {
+		fmt.Println("Error creating Matomo request:", err)
+		return
+	}
+	matomoReq.Header = header.Clone()
+	matomoReq.Header.Set("Content-Type", "application/json")
+
+	m.doMatomoRequest(matomoReq)
+}
+
+// sendMatomoRequest sends a single tracking request with the given query and headers.
+func (m *MatomoTracking) sendMatomoRequest(matomoURL *url.URL, query url.Values, header http.Header) {
+	matomoReqURL := *matomoURL
+	matomoReqURL.RawQuery = query.Encode()
+	fmt.Println("Matomo query string:", matomoReqURL.RawQuery)
+
+	// Create the Matomo request
+	matomoReq, err := http.NewRequest("GET", matomoReqURL.String(), nil)
+	if err != nil {
+		fmt.Println("Error creating Matomo request:", err)
+		return
 	}
+	matomoReq.Header = header.Clone()
+
+	m.doMatomoRequest(matomoReq)
+}
 
+// doMatomoRequest sends a prepared request to Matomo and logs the outcome.
+func (m *MatomoTracking) doMatomoRequest(matomoReq *http.Request) {
 	fmt.Println("Matomo tracking request: ", matomoReq)
 
 	// Create a custom HTTP client with timeouts
@@ -276,26 +542,20 @@ func isPathExcluded(path string, excludedPaths, includedPaths []string) bool {
 func mergeConfigs(base DomainConfig, override PathConfig) DomainConfig {
 	merged := base // Start with the domain-level config
 
-	if override.TrackingEnabled != nil {
-		merged.TrackingEnabled = *override.TrackingEnabled
-	}
+	// Nested overrides are resolved by flattenPathOverrides in New
+	override.PathOverrides = nil
 
-	if override.IdSite != nil {
-		merged.IdSite = *override.IdSite
-	}
+	// Every field set in the override replaces the domain-level field of the
+	// same name; slices are replaced completely
+	overrideFields(reflect.ValueOf(&merged).Elem(), reflect.ValueOf(override))
 
-	// For slice overrides, we completely replace the base slices
-	if override.ExcludedPaths != nil {
-		merged.ExcludedPaths = override.ExcludedPaths
-	}
-
-	if override.IncludedPaths != nil {
-		merged.IncludedPaths = override.IncludedPaths
-	}
-
-	if override.ResponseConditions != nil {
-		merged.ResponseConditions = override.ResponseConditions
-	}
+	// List modifiers add to or remove from the (possibly replaced) lists
+	merged.ExcludedPaths = mergeStringList(merged.ExcludedPaths, override.ExcludedPathsAppend, override.ExcludedPathsRemove)
+	merged.IncludedPaths = mergeStringList(merged.IncludedPaths, override.IncludedPathsAppend, override.IncludedPathsRemove)
+	merged.ExcludedIPs = mergeStringList(merged.ExcludedIPs, override.ExcludedIPsAppend, override.ExcludedIPsRemove)
+	merged.IncludedIPs = mergeStringList(merged.IncludedIPs, override.IncludedIPsAppend, override.IncludedIPsRemove)
+	merged.Goals = mergeGoals(merged.Goals, override.GoalsAppend, override.GoalsRemove)
+	merged.Dimensions = mergeDimensions(merged.Dimensions, override.DimensionsAppend, override.DimensionsRemove)
 	return merged
 }
 
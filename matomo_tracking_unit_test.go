@@ -1,7 +1,13 @@
 package MatomoTracking
 
 import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
 	"testing"
+	"time"
 )
 
 func boolPtr(b bool) *bool { return &b }
@@ -93,3 +99,42 @@ func TestIsPathExcluded(t *testing.T) {
 		}
 	}
 }
+
+// startHitCollector stands in for Matomo and sends every tracking request it
+// receives on the returned channel.
+func startHitCollector(t *testing.T) (string, <-chan *http.Request) {
+	t.Helper()
+
+	ch := make(chan *http.Request, 16)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		clone := r.Clone(context.Background())
+		clone.Body = io.NopCloser(bytes.NewReader(body))
+		ch <- clone
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(srv.Close)
+	return srv.URL + "/matomo.php", ch
+}
+
+// expectHit waits for the next tracking request on ch.
+func expectHit(t *testing.T, ch <-chan *http.Request) *http.Request {
+	t.Helper()
+	select {
+	case r := <-ch:
+		return r
+	case <-time.After(2 * time.Second):
+		t.Fatal("did not observe Matomo tracking request")
+		return nil
+	}
+}
+
+// expectNoHit fails if a tracking request arrives on ch.
+func expectNoHit(t *testing.T, ch <-chan *http.Request) {
+	t.Helper()
+	select {
+	case r := <-ch:
+		t.Fatalf("unexpected Matomo tracking request: %s", r.URL.RawQuery)
+	case <-time.After(300 * time.Millisecond):
+	}
+}
@@ -0,0 +1,50 @@
+package MatomoTracking
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// MethodsConfig restricts tracking to certain HTTP methods.
+type MethodsConfig struct {
+	// Track lists the methods tracked as pageviews. Empty = GET only.
+	Track []string `json:"track,omitempty"`
+	// AsEvents lists methods recorded as Matomo events (category "HTTP", action = method, name = path)
+	// instead of pageviews. These methods are tracked even if they are not listed in Track.
+	AsEvents []string `json:"asEvents,omitempty"`
+}
+
+// applyMethods returns false if the request method must not be tracked.
+// Methods configured as events turn the hit into an event.
+func applyMethods(req *http.Request, mc *MethodsConfig, hit *trackingHit) bool {
+	if mc == nil {
+		return true
+	}
+
+	if methodInList(req.Method, mc.AsEvents) {
+		fmt.Println("Recording method as event:", req.Method)
+		hit.setEvent("HTTP", req.Method, req.URL.Path)
+		return true
+	}
+
+	track := mc.Track
+	if len(track) == 0 {
+		track = []string{http.MethodGet}
+	}
+	if methodInList(req.Method, track) {
+		return true
+	}
+
+	fmt.Println("Method not tracked:", req.Method)
+	return false
+}
+
+func methodInList(method string, methods []string) bool {
+	for _, m := range methods {
+		if strings.EqualFold(strings.TrimSpace(m), method) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,78 @@
+package MatomoTracking
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestApplyMethods(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name      string
+		mc        *MethodsConfig
+		method    string
+		wantTrack bool
+		wantEvent bool
+	}{
+		{"nil config tracks all", nil, http.MethodOptions, true, false},
+		{"default GET", &MethodsConfig{}, http.MethodGet, true, false},
+		{"default skips HEAD", &MethodsConfig{}, http.MethodHead, false, false},
+		{"default skips preflight", &MethodsConfig{}, http.MethodOptions, false, false},
+		{"listed", &MethodsConfig{Track: []string{"get", "POST"}}, http.MethodPost, true, false},
+		{"not listed", &MethodsConfig{Track: []string{"GET", "POST"}}, http.MethodPut, false, false},
+		{"as event", &MethodsConfig{AsEvents: []string{"POST", "PUT"}}, http.MethodPut, true, true},
+		{"GET stays pageview", &MethodsConfig{AsEvents: []string{"POST"}}, http.MethodGet, true, false},
+	}
+	for _, tc := range cases {
+		req := httptest.NewRequest(tc.method, "http://example.com/form", nil)
+		hit := trackingHit{params: map[string][]string{}}
+		if got := applyMethods(req, tc.mc, &hit); got != tc.wantTrack {
+			t.Fatalf("%s: applyMethods() = %v; want %v", tc.name, got, tc.wantTrack)
+		}
+		if isEvent := hit.params.Get("e_c") == "HTTP"; isEvent != tc.wantEvent {
+			t.Fatalf("%s: event = %v; want %v", tc.name, isEvent, tc.wantEvent)
+		}
+		if tc.wantEvent && (hit.params.Get("e_a") != tc.method || hit.params.Get("e_n") != "/form") {
+			t.Fatalf("%s: unexpected event params %v", tc.name, hit.params)
+		}
+	}
+}
+
+func TestServeHTTP_MethodsPathOverride(t *testing.T) {
+	t.Parallel()
+
+	matomoURL, hits := startHitCollector(t)
+	cfg := &Config{
+		MatomoURL: matomoURL,
+		Domains: map[string]DomainConfig{
+			"example.com": {
+				TrackingEnabled: true,
+				IdSite:          1,
+				Methods:         &MethodsConfig{},
+				PathOverrides: map[string]PathConfig{
+					"/forms": {Methods: &MethodsConfig{AsEvents: []string{"POST"}}},
+				},
+			},
+		},
+	}
+	h, err := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}), cfg, "test")
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodHead, "http://example.com/health", nil)
+	req.RemoteAddr = "203.0.113.9:54321"
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	expectNoHit(t, hits)
+
+	req = httptest.NewRequest(http.MethodPost, "http://example.com/forms/contact", nil)
+	req.RemoteAddr = "203.0.113.9:54321"
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	q := expectHit(t, hits).URL.Query()
+	if q.Get("e_c") != "HTTP" || q.Get("e_a") != http.MethodPost || q.Get("e_n") != "/forms/contact" {
+		t.Fatalf("unexpected event params: %v", q)
+	}
+}
@@ -0,0 +1,29 @@
+package MatomoTracking
+
+import (
+	"strconv"
+	"time"
+)
+
+// applyPerformance adds the server timings and the response size recorded by
+// rec to the main hit. pf_srv is the time until the final header was written
+// (time to first byte), pf_tfr the time spent writing the body after that.
+// If the hit is decided before the body is written (trackAt: headers), only
+// pf_srv is known.
+func applyPerformance(rec *statusRecorder, hit *trackingHit) {
+	srv := rec.firstByte.Sub(rec.start)
+	hit.params.Set("pf_srv", strconv.FormatInt(durationMillis(srv), 10))
+	if rec.end.IsZero() {
+		return
+	}
+	tfr := rec.end.Sub(rec.firstByte)
+	hit.params.Set("pf_tfr", strconv.FormatInt(durationMillis(tfr), 10))
+	hit.params.Set("bw_bytes", strconv.FormatInt(rec.bytes, 10))
+}
+
+func durationMillis(d time.Duration) int64 {
+	if d < 0 {
+		return 0
+	}
+	return d.Milliseconds()
+}
@@ -0,0 +1,82 @@
+package MatomoTracking
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestApplyPerformance(t *testing.T) {
+	t.Parallel()
+
+	rec := newStatusRecorder(httptest.NewRecorder())
+	time.Sleep(20 * time.Millisecond)
+	rec.WriteHeader(http.StatusOK)
+	time.Sleep(20 * time.Millisecond)
+	rec.Write([]byte("hello"))
+	rec.Write([]byte(" world"))
+	rec.finish()
+
+	hit := trackingHit{params: map[string][]string{}}
+	applyPerformance(rec, &hit)
+	srv, _ := strconv.Atoi(hit.params.Get("pf_srv"))
+	tfr, _ := strconv.Atoi(hit.params.Get("pf_tfr"))
+	if srv < 20 || tfr < 20 {
+		t.Fatalf("pf_srv = %d, pf_tfr = %d; want both >= 20", srv, tfr)
+	}
+	if got := hit.params.Get("bw_bytes"); got != "11" {
+		t.Fatalf("bw_bytes = %q; want 11", got)
+	}
+}
+
+func TestApplyPerformance_NoBody(t *testing.T) {
+	t.Parallel()
+
+	rec := newStatusRecorder(httptest.NewRecorder())
+	rec.finish()
+
+	hit := trackingHit{params: map[string][]string{}}
+	applyPerformance(rec, &hit)
+	if hit.params.Get("pf_tfr") != "0" || hit.params.Get("bw_bytes") != "0" {
+		t.Fatalf("unexpected params: %v", hit.params)
+	}
+}
+
+func TestServeHTTP_PerformanceOnlyOnMainHit(t *testing.T) {
+	t.Parallel()
+
+	matomoURL, hits := startHitCollector(t)
+	cfg := &Config{
+		MatomoURL: matomoURL,
+		Domains: map[string]DomainConfig{
+			"example.com": {
+				TrackingEnabled: true,
+				IdSite:          1,
+				Goals:           []GoalConfig{{ID: 2}},
+			},
+		},
+	}
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("<html></html>"))
+	})
+	h, err := New(context.Background(), next, cfg, "test")
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "http://example.com/", nil)
+	req.RemoteAddr = "203.0.113.9:54321"
+	h.ServeHTTP(httptest.NewRecorder(), req)
+
+	q := expectHit(t, hits).URL.Query()
+	if q.Get("bw_bytes") != "13" || q.Get("pf_srv") == "" {
+		t.Fatalf("unexpected main hit params: %v", q)
+	}
+	q = expectHit(t, hits).URL.Query()
+	if q.Get("idgoal") != "2" || q.Get("bw_bytes") != "" || q.Get("pf_srv") != "" {
+		t.Fatalf("unexpected goal hit params: %v", q)
+	}
+}
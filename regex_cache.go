@@ -0,0 +1,35 @@
+package MatomoTracking
+
+import (
+	"regexp"
+	"sync"
+)
+
+// Config patterns are evaluated on every request, so each distinct pattern is
+// compiled once and reused. Compile errors are cached as well, so an invalid
+// pattern is not recompiled per request either.
+var (
+	regexCacheMu sync.RWMutex
+	regexCache   = map[string]compiledRegex{}
+)
+
+type compiledRegex struct {
+	re  *regexp.Regexp
+	err error
+}
+
+// cachedRegexp returns the compiled form of pattern, compiling it on first use.
+func cachedRegexp(pattern string) (*regexp.Regexp, error) {
+	regexCacheMu.RLock()
+	c, ok := regexCache[pattern]
+	regexCacheMu.RUnlock()
+	if ok {
+		return c.re, c.err
+	}
+
+	re, err := regexp.Compile(pattern)
+	regexCacheMu.Lock()
+	regexCache[pattern] = compiledRegex{re: re, err: err}
+	regexCacheMu.Unlock()
+	return re, err
+}
@@ -0,0 +1,20 @@
+package MatomoTracking
+
+import "testing"
+
+func TestCachedRegexp(t *testing.T) {
+	t.Parallel()
+
+	first, err := cachedRegexp(`^/cache-test/(\d+)$`)
+	if err != nil || !first.MatchString("/cache-test/42") {
+		t.Fatalf("cachedRegexp() = %v, %v", first, err)
+	}
+	if second, _ := cachedRegexp(`^/cache-test/(\d+)$`); second != first {
+		t.Fatalf("pattern compiled twice")
+	}
+	for i := 0; i < 2; i++ {
+		if re, err := cachedRegexp(`(`); err == nil || re != nil {
+			t.Fatalf("invalid pattern = %v, %v; want error", re, err)
+		}
+	}
+}
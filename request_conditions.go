@@ -0,0 +1,106 @@
+package MatomoTracking
+
+import (
+	"net"
+	"net/http"
+	"strconv"
+)
+
+// RequestConditions define when to track based on the incoming request.
+type RequestConditions struct {
+	// All request headers must satisfy their matcher.
+	Headers map[string]ValueMatcher `json:"headers,omitempty"`
+	// All cookies must satisfy their matcher (cookie names are case-sensitive).
+	Cookies map[string]ValueMatcher `json:"cookies,omitempty"`
+	// All query parameters must satisfy their matcher.
+	Query map[string]ValueMatcher `json:"query,omitempty"`
+	// Track only if the port of the requested host is one of these. Empty = allow any.
+	Ports []int `json:"ports,omitempty"`
+	// At least one of these nested conditions must match. Empty = no constraint.
+	AnyOf []RequestConditions `json:"anyOf,omitempty"`
+	// All of these nested conditions must match.
+	AllOf []RequestConditions `json:"allOf,omitempty"`
+	// This nested condition must not match.
+	Not *RequestConditions `json:"not,omitempty"`
+}
+
+// matchesRequestConditions returns true if rc is nil or all conditions match.
+func matchesRequestConditions(req *http.Request, rc *RequestConditions) bool {
+	if rc == nil {
+		return true
+	}
+	for k, vm := range rc.Headers {
+		if !vm.matches(req.Header.Values(k)) {
+			return false
+		}
+	}
+	for name, vm := range rc.Cookies {
+		if !vm.matches(cookieValues(req, name)) {
+			return false
+		}
+	}
+	query := req.URL.Query()
+	for k, vm := range rc.Query {
+		if !vm.matches(query[k]) {
+			return false
+		}
+	}
+	if len(rc.Ports) > 0 {
+		port := requestPort(req)
+		ok := false
+		for _, p := range rc.Ports {
+			if p == port {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return false
+		}
+	}
+	// Nested groups
+	for i := range rc.AllOf {
+		if !matchesRequestConditions(req, &rc.AllOf[i]) {
+			return false
+		}
+	}
+	if len(rc.AnyOf) > 0 {
+		ok := false
+		for i := range rc.AnyOf {
+			if matchesRequestConditions(req, &rc.AnyOf[i]) {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return false
+		}
+	}
+	if rc.Not != nil && matchesRequestConditions(req, rc.Not) {
+		return false
+	}
+	return true
+}
+
+func cookieValues(req *http.Request, name string) []string {
+	var values []string
+	for _, c := range req.Cookies() {
+		if c.Name == name {
+			values = append(values, c.Value)
+		}
+	}
+	return values
+}
+
+// requestPort returns the port of the requested host, defaulting to 80/443.
+func requestPort(req *http.Request) int {
+	if _, port, err := net.SplitHostPort(req.Host); err == nil {
+		if p, err := strconv.Atoi(port); err == nil {
+			return p
+		}
+	}
+	if req.TLS != nil {
+		return 443
+	}
+	return 80
+}
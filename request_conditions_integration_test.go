@@ -0,0 +1,87 @@
+package MatomoTracking
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestIntegration_RequestConditions(t *testing.T) {
+	base := localMatomoURL()
+	if _, ok := waitForMatomo(t, base, 5*time.Second); !ok {
+		return
+	}
+
+	cfg := func(proxyURL string) *Config {
+		return &Config{
+			MatomoURL: proxyURL,
+			Domains: map[string]DomainConfig{
+				"demo.localhost": {
+					TrackingEnabled: true,
+					IdSite:          1, // ensure site 1 exists in your local Matomo
+					RequestConditions: &RequestConditions{
+						Headers: map[string]ValueMatcher{"X-Internal-Check": {Absent: true}},
+					},
+				},
+			},
+		}
+	}
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=UTF-8")
+		_, _ = w.Write([]byte("<html>ok</html>"))
+	})
+
+	t.Run("tracks regular request", func(t *testing.T) {
+		proxyURL, statusCh, closeProxy := startMatomoProbeProxy(t, base+"/matomo.php")
+		defer closeProxy()
+
+		h, err := New(context.Background(), next, cfg(proxyURL), "test")
+		if err != nil {
+			t.Fatalf("New() error = %v", err)
+		}
+
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "http://demo.localhost/reqc-test", nil)
+		req.RemoteAddr = "203.0.113.9:54321"
+		req.Header.Set("User-Agent", "ReqC-IT-UA")
+		h.ServeHTTP(rr, req)
+
+		select {
+		case code := <-statusCh:
+			if code < 200 || code >= 300 {
+				t.Fatalf("Matomo tracking failed: status %d", code)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatal("did not observe Matomo tracking request (expected due to matching conditions)")
+		}
+	})
+
+	t.Run("skips internal check", func(t *testing.T) {
+		proxyURL, statusCh, closeProxy := startMatomoProbeProxy(t, base+"/matomo.php")
+		defer closeProxy()
+
+		h, err := New(context.Background(), next, cfg(proxyURL), "test")
+		if err != nil {
+			t.Fatalf("New() error = %v", err)
+		}
+
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "http://demo.localhost/reqc-test", nil)
+		req.RemoteAddr = "203.0.113.9:54321"
+		req.Header.Set("User-Agent", "ReqC-IT-UA")
+		req.Header.Set("X-Internal-Check", "1")
+		h.ServeHTTP(rr, req)
+
+		select {
+		case code := <-statusCh:
+			t.Fatalf("unexpected Matomo call (status %d) despite non-matching conditions", code)
+		case <-time.After(1 * time.Second):
+			// expected: no call
+			fmt.Println("no tracking call observed as expected")
+		}
+	})
+}
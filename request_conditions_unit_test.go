@@ -0,0 +1,134 @@
+package MatomoTracking
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestMatchesRequestConditions_Nil(t *testing.T) {
+	t.Parallel()
+	req := httptest.NewRequest(http.MethodGet, "http://example.com/", nil)
+	if !matchesRequestConditions(req, nil) {
+		t.Fatalf("nil conditions should allow any request")
+	}
+}
+
+func TestMatchesRequestConditions_HeadersCookiesQuery(t *testing.T) {
+	t.Parallel()
+
+	// Skip internal checks and previews, track only the German site
+	rc := &RequestConditions{
+		Headers: map[string]ValueMatcher{"X-Internal-Check": {Absent: true}},
+		Cookies: map[string]ValueMatcher{"preview": {Absent: true}},
+		Query:   map[string]ValueMatcher{"lang": {EqualsFold: "de"}},
+	}
+
+	newReq := func() *http.Request {
+		return httptest.NewRequest(http.MethodGet, "http://example.com/page?lang=DE", nil)
+	}
+
+	if !matchesRequestConditions(newReq(), rc) {
+		t.Fatalf("expected plain request to match")
+	}
+
+	req := newReq()
+	req.Header.Set("x-internal-check", "1")
+	if matchesRequestConditions(req, rc) {
+		t.Fatalf("expected internal check header to fail")
+	}
+
+	req = newReq()
+	req.AddCookie(&http.Cookie{Name: "preview", Value: "1"})
+	if matchesRequestConditions(req, rc) {
+		t.Fatalf("expected preview cookie to fail")
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "http://example.com/page?lang=en", nil)
+	if matchesRequestConditions(req, rc) {
+		t.Fatalf("expected query mismatch to fail")
+	}
+
+	// Cookie value matching
+	rc = &RequestConditions{Cookies: map[string]ValueMatcher{"tenant": {Regex: "^acme-"}}}
+	req = newReq()
+	req.AddCookie(&http.Cookie{Name: "tenant", Value: "acme-1"})
+	if !matchesRequestConditions(req, rc) {
+		t.Fatalf("expected cookie value to match")
+	}
+}
+
+func TestMatchesRequestConditions_Ports(t *testing.T) {
+	t.Parallel()
+
+	rc := &RequestConditions{Ports: []int{443, 8443}}
+
+	cases := []struct {
+		host string
+		tls  bool
+		want bool
+	}{
+		{"example.com", false, false},
+		{"example.com", true, true},
+		{"example.com:8443", false, true},
+		{"example.com:8080", true, false},
+	}
+	for _, tc := range cases {
+		req := httptest.NewRequest(http.MethodGet, "http://example.com/", nil)
+		req.Host = tc.host
+		if tc.tls {
+			req.TLS = &tls.ConnectionState{}
+		}
+		if got := matchesRequestConditions(req, rc); got != tc.want {
+			t.Fatalf("host %q (tls=%v): got %v; want %v", tc.host, tc.tls, got, tc.want)
+		}
+	}
+}
+
+func TestMatchesRequestConditions_Groups(t *testing.T) {
+	t.Parallel()
+
+	rc := &RequestConditions{
+		AnyOf: []RequestConditions{
+			{Query: map[string]ValueMatcher{"utm_source": {Present: true}}},
+			{Headers: map[string]ValueMatcher{"Referer": {Prefix: "https://partner.example/"}}},
+		},
+		Not: &RequestConditions{Headers: map[string]ValueMatcher{"DNT": {Equals: "1"}}},
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "http://example.com/?utm_source=news", nil)
+	if !matchesRequestConditions(req, rc) {
+		t.Fatalf("expected campaign request to match")
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "http://example.com/", nil)
+	req.Header.Set("Referer", "https://partner.example/list")
+	if !matchesRequestConditions(req, rc) {
+		t.Fatalf("expected partner referer to match")
+	}
+
+	req.Header.Set("DNT", "1")
+	if matchesRequestConditions(req, rc) {
+		t.Fatalf("expected not group to reject DNT")
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "http://example.com/", nil)
+	if matchesRequestConditions(req, rc) {
+		t.Fatalf("expected anyOf without match to fail")
+	}
+}
+
+func TestMergeConfigs_RequestConditions(t *testing.T) {
+	t.Parallel()
+
+	domain := &RequestConditions{Ports: []int{443}}
+	path := &RequestConditions{Ports: []int{8443}}
+
+	if got := mergeConfigs(DomainConfig{RequestConditions: domain}, PathConfig{}); got.RequestConditions != domain {
+		t.Fatalf("expected domain request conditions to be inherited")
+	}
+	if got := mergeConfigs(DomainConfig{RequestConditions: domain}, PathConfig{RequestConditions: path}); got.RequestConditions != path {
+		t.Fatalf("expected path request conditions to override")
+	}
+}
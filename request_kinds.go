@@ -0,0 +1,99 @@
+package MatomoTracking
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Request kinds derived from Fetch Metadata and the Accept header.
+const (
+	kindNavigation  = "navigation"  // top-level document navigation
+	kindFrame       = "frame"       // navigation inside an iframe, frame, embed or object
+	kindAPI         = "api"         // fetch/XHR calls and WebSockets
+	kindSubresource = "subresource" // scripts, styles, images, fonts, ...
+	kindPrefetch    = "prefetch"    // speculative prefetch/prerender loads, never tracked
+	kindUnknown     = "unknown"     // no Fetch Metadata and an inconclusive Accept header
+)
+
+// RequestKindsConfig restricts tracking to certain kinds of requests.
+type RequestKindsConfig struct {
+	// Track lists the request kinds that are tracked: navigation, frame, api, subresource, unknown.
+	// Empty = navigation only. Prefetch and prerender loads are never tracked.
+	Track []string `json:"track,omitempty"`
+	// APIAsEvents records API calls as Matomo events (category "API", action = method, name = path)
+	// instead of pageviews. API calls are then tracked even if "api" is not listed in Track.
+	APIAsEvents bool `json:"apiAsEvents,omitempty"`
+}
+
+// classifyRequestKind determines what kind of request the browser made.
+func classifyRequestKind(req *http.Request) string {
+	// Speculative loads (Chrome: Sec-Purpose, older browsers: Purpose / X-Moz)
+	for _, name := range []string{"Sec-Purpose", "Purpose", "X-Purpose", "X-Moz"} {
+		value := strings.ToLower(req.Header.Get(name))
+		if strings.Contains(value, "prefetch") || strings.Contains(value, "prerender") || strings.Contains(value, "preview") {
+			return kindPrefetch
+		}
+	}
+
+	if mode := strings.ToLower(req.Header.Get("Sec-Fetch-Mode")); mode != "" {
+		dest := strings.ToLower(req.Header.Get("Sec-Fetch-Dest"))
+		switch {
+		case mode == "navigate" || mode == "nested-navigate":
+			switch dest {
+			case "iframe", "frame", "embed", "object", "fencedframe":
+				return kindFrame
+			default:
+				return kindNavigation
+			}
+		case mode == "websocket" || dest == "" || dest == "empty":
+			return kindAPI
+		default:
+			return kindSubresource
+		}
+	}
+
+	// No Fetch Metadata: fall back to the Accept header
+	accept := strings.ToLower(req.Header.Get("Accept"))
+	switch {
+	case strings.Contains(accept, "text/html") || strings.Contains(accept, "application/xhtml+xml"):
+		return kindNavigation
+	case strings.Contains(accept, "json") || strings.EqualFold(req.Header.Get("X-Requested-With"), "XMLHttpRequest"):
+		return kindAPI
+	case strings.HasPrefix(accept, "image/") || strings.HasPrefix(accept, "text/css") ||
+		strings.Contains(accept, "javascript") || strings.HasPrefix(accept, "font/"):
+		return kindSubresource
+	default:
+		return kindUnknown
+	}
+}
+
+// applyRequestKinds classifies the request and returns false if its kind must
+// not be tracked. API calls are turned into events if configured.
+func applyRequestKinds(req *http.Request, rk *RequestKindsConfig, hit *trackingHit) bool {
+	if rk == nil {
+		return true
+	}
+
+	kind := classifyRequestKind(req)
+	fmt.Println("Request kind:", kind)
+
+	if kind == kindPrefetch {
+		return false
+	}
+	if kind == kindAPI && rk.APIAsEvents {
+		hit.setEvent("API", req.Method, req.URL.Path)
+		return true
+	}
+
+	track := rk.Track
+	if len(track) == 0 {
+		track = []string{kindNavigation}
+	}
+	for _, allowed := range track {
+		if strings.EqualFold(allowed, kind) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,125 @@
+package MatomoTracking
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClassifyRequestKind(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name    string
+		headers map[string]string
+		want    string
+	}{
+		{"top-level navigation", map[string]string{"Sec-Fetch-Mode": "navigate", "Sec-Fetch-Dest": "document"}, kindNavigation},
+		{"iframe", map[string]string{"Sec-Fetch-Mode": "navigate", "Sec-Fetch-Dest": "iframe"}, kindFrame},
+		{"fetch", map[string]string{"Sec-Fetch-Mode": "cors", "Sec-Fetch-Dest": "empty"}, kindAPI},
+		{"websocket", map[string]string{"Sec-Fetch-Mode": "websocket", "Sec-Fetch-Dest": "websocket"}, kindAPI},
+		{"script", map[string]string{"Sec-Fetch-Mode": "no-cors", "Sec-Fetch-Dest": "script"}, kindSubresource},
+		{"chrome prefetch", map[string]string{"Sec-Purpose": "prefetch", "Sec-Fetch-Mode": "navigate", "Sec-Fetch-Dest": "document"}, kindPrefetch},
+		{"chrome prerender", map[string]string{"Sec-Purpose": "prefetch;prerender", "Sec-Fetch-Mode": "navigate"}, kindPrefetch},
+		{"legacy prefetch", map[string]string{"Purpose": "prefetch", "Accept": "text/html"}, kindPrefetch},
+		{"firefox prefetch", map[string]string{"X-Moz": "prefetch"}, kindPrefetch},
+		{"legacy html", map[string]string{"Accept": "text/html,application/xhtml+xml,*/*;q=0.8"}, kindNavigation},
+		{"legacy json", map[string]string{"Accept": "application/json"}, kindAPI},
+		{"legacy xhr", map[string]string{"Accept": "*/*", "X-Requested-With": "XMLHttpRequest"}, kindAPI},
+		{"legacy image", map[string]string{"Accept": "image/avif,image/webp,*/*"}, kindSubresource},
+		{"no hints", map[string]string{"Accept": "*/*"}, kindUnknown},
+	}
+
+	for _, tc := range cases {
+		req := httptest.NewRequest(http.MethodGet, "http://example.com/", nil)
+		for k, v := range tc.headers {
+			req.Header.Set(k, v)
+		}
+		if got := classifyRequestKind(req); got != tc.want {
+			t.Fatalf("%s: classifyRequestKind() = %q; want %q", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestApplyRequestKinds(t *testing.T) {
+	t.Parallel()
+
+	newReq := func(mode, dest string) *http.Request {
+		req := httptest.NewRequest(http.MethodPost, "http://example.com/api/items", nil)
+		req.Header.Set("Sec-Fetch-Mode", mode)
+		req.Header.Set("Sec-Fetch-Dest", dest)
+		return req
+	}
+
+	cases := []struct {
+		name      string
+		rk        *RequestKindsConfig
+		req       *http.Request
+		wantTrack bool
+		wantEvent bool
+	}{
+		{"nil config tracks all", nil, newReq("cors", "empty"), true, false},
+		{"default navigation only", &RequestKindsConfig{}, newReq("navigate", "document"), true, false},
+		{"default skips api", &RequestKindsConfig{}, newReq("cors", "empty"), false, false},
+		{"default skips frames", &RequestKindsConfig{}, newReq("navigate", "iframe"), false, false},
+		{"frames listed", &RequestKindsConfig{Track: []string{"navigation", "frame"}}, newReq("navigate", "iframe"), true, false},
+		{"api as events", &RequestKindsConfig{APIAsEvents: true}, newReq("cors", "empty"), true, true},
+	}
+	for _, tc := range cases {
+		hit := trackingHit{params: map[string][]string{}}
+		if got := applyRequestKinds(tc.req, tc.rk, &hit); got != tc.wantTrack {
+			t.Fatalf("%s: applyRequestKinds() = %v; want %v", tc.name, got, tc.wantTrack)
+		}
+		if isEvent := hit.params.Get("e_c") != ""; isEvent != tc.wantEvent {
+			t.Fatalf("%s: event = %v; want %v", tc.name, isEvent, tc.wantEvent)
+		}
+	}
+
+	// Prefetches are never tracked, even if listed
+	req := newReq("navigate", "document")
+	req.Header.Set("Sec-Purpose", "prefetch")
+	hit := trackingHit{params: map[string][]string{}}
+	if applyRequestKinds(req, &RequestKindsConfig{Track: []string{"navigation", "prefetch"}}, &hit) {
+		t.Fatalf("prefetch must not be tracked")
+	}
+}
+
+func TestServeHTTP_RequestKindsAPIEvent(t *testing.T) {
+	t.Parallel()
+
+	matomoURL, hits := startHitCollector(t)
+	cfg := &Config{
+		MatomoURL: matomoURL,
+		Domains: map[string]DomainConfig{
+			"example.com": {
+				TrackingEnabled: true,
+				IdSite:          1,
+				RequestKinds:    &RequestKindsConfig{APIAsEvents: true},
+			},
+		},
+	}
+	h, err := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}), cfg, "test")
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "http://example.com/api/items", nil)
+	req.RemoteAddr = "203.0.113.9:54321"
+	req.Header.Set("Sec-Fetch-Mode", "cors")
+	req.Header.Set("Sec-Fetch-Dest", "empty")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+
+	q := expectHit(t, hits).URL.Query()
+	if q.Get("e_c") != "API" || q.Get("e_a") != http.MethodPost || q.Get("e_n") != "/api/items" {
+		t.Fatalf("unexpected event params: %v", q)
+	}
+
+	// Subresources are not tracked
+	req = httptest.NewRequest(http.MethodGet, "http://example.com/app.js", nil)
+	req.RemoteAddr = "203.0.113.9:54321"
+	req.Header.Set("Sec-Fetch-Mode", "no-cors")
+	req.Header.Set("Sec-Fetch-Dest", "script")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	expectNoHit(t, hits)
+}
@@ -1,6 +1,17 @@
 package MatomoTracking
 
-import "net/http"
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Points at which the tracking decision is made.
+const (
+	trackAtCompletion = "completion" // after the handler has returned (default)
+	trackAtHeaders    = "headers"    // as soon as the final header is written
+)
 
 // ResponseConditions define when to track based on the final response.
 type ResponseConditions struct {
@@ -8,30 +19,35 @@ type ResponseConditions struct {
 	TrackOnStatusCodes []int `json:"trackOnStatusCodes,omitempty"`
 	// All headers must be present and equal to the given value (exact match, case-insensitive keys).
 	TrackWhenHeaders map[string]string `json:"trackWhenHeaders,omitempty"`
-}
-
-// statusRecorder captures the final status while delegating to the real ResponseWriter.
-type statusRecorder struct {
-	http.ResponseWriter
-	status int
-}
-
-func newStatusRecorder(w http.ResponseWriter) *statusRecorder {
-	// Default to 200 unless WriteHeader is called explicitly.
-	return &statusRecorder{ResponseWriter: w, status: http.StatusOK}
-}
-
-func (w *statusRecorder) WriteHeader(code int) {
-	w.status = code
-	w.ResponseWriter.WriteHeader(code)
+	// All headers must satisfy their matcher (equals, equalsFold, prefix, regex, mediaType, present, absent).
+	Headers map[string]ValueMatcher `json:"headers,omitempty"`
+	// Track only if the final status matches one of these: exact codes ("404"),
+	// classes ("2xx") or ranges ("200-299"). Empty = allow any.
+	StatusCodes []string `json:"statusCodes,omitempty"`
+	// Never track if the final status matches one of these (same syntax as StatusCodes).
+	NotStatusCodes []string `json:"notStatusCodes,omitempty"`
+	// At least one of these nested conditions must match. Empty = no constraint.
+	AnyOf []ResponseConditions `json:"anyOf,omitempty"`
+	// All of these nested conditions must match.
+	AllOf []ResponseConditions `json:"allOf,omitempty"`
+	// This nested condition must not match.
+	Not *ResponseConditions `json:"not,omitempty"`
+	// OnlyCompleted skips responses that did not complete (handler panic,
+	// write error or client disconnect).
+	OnlyCompleted bool `json:"onlyCompleted,omitempty"`
 }
 
 // matchesResponseConditions returns true if rc is nil or all conditions match.
-func matchesResponseConditions(status int, hdr http.Header, rc *ResponseConditions) bool {
+// Every field of a ResponseConditions node is ANDed; anyOf, allOf and not
+// nest further nodes, so the conditions form a small tree.
+func matchesResponseConditions(status int, hdr http.Header, completed bool, rc *ResponseConditions) bool {
 	if rc == nil {
 		return true
 	}
-	// Status filter
+	if rc.OnlyCompleted && !completed {
+		return false
+	}
+	// Status filters
 	if len(rc.TrackOnStatusCodes) > 0 {
 		ok := false
 		for _, s := range rc.TrackOnStatusCodes {
@@ -44,6 +60,12 @@ func matchesResponseConditions(status int, hdr http.Header, rc *ResponseConditio
 			return false
 		}
 	}
+	if len(rc.StatusCodes) > 0 && !matchesAnyStatusSpec(status, rc.StatusCodes) {
+		return false
+	}
+	if matchesAnyStatusSpec(status, rc.NotStatusCodes) {
+		return false
+	}
 	// Header filters (exact value match)
 	for k, want := range rc.TrackWhenHeaders {
 		found := false
@@ -57,5 +79,92 @@ func matchesResponseConditions(status int, hdr http.Header, rc *ResponseConditio
 			return false
 		}
 	}
+	// Header matchers
+	for k, vm := range rc.Headers {
+		if !vm.matches(hdr.Values(k)) {
+			return false
+		}
+	}
+	// Nested groups
+	for i := range rc.AllOf {
+		if !matchesResponseConditions(status, hdr, completed, &rc.AllOf[i]) {
+			return false
+		}
+	}
+	if len(rc.AnyOf) > 0 {
+		ok := false
+		for i := range rc.AnyOf {
+			if matchesResponseConditions(status, hdr, completed, &rc.AnyOf[i]) {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return false
+		}
+	}
+	if rc.Not != nil && matchesResponseConditions(status, hdr, completed, rc.Not) {
+		return false
+	}
 	return true
 }
+
+// usesOnlyCompleted reports whether onlyCompleted is set anywhere in rc.
+func usesOnlyCompleted(rc *ResponseConditions) bool {
+	if rc == nil {
+		return false
+	}
+	if rc.OnlyCompleted || usesOnlyCompleted(rc.Not) {
+		return true
+	}
+	for i := range rc.AnyOf {
+		if usesOnlyCompleted(&rc.AnyOf[i]) {
+			return true
+		}
+	}
+	for i := range rc.AllOf {
+		if usesOnlyCompleted(&rc.AllOf[i]) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesAnyStatusSpec reports whether status matches one of the given specs.
+func matchesAnyStatusSpec(status int, specs []string) bool {
+	for _, spec := range specs {
+		if matchesStatusSpec(status, spec) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesStatusSpec matches a status against an exact code ("404"), a class
+// ("2xx") or an inclusive range ("200-299"). Invalid specs never match.
+func matchesStatusSpec(status int, spec string) bool {
+	spec = strings.ToLower(strings.TrimSpace(spec))
+
+	// Status class, e.g. 2xx
+	if len(spec) == 3 && strings.HasSuffix(spec, "xx") && spec[0] >= '1' && spec[0] <= '5' {
+		return status/100 == int(spec[0]-'0')
+	}
+
+	// Range, e.g. 200-299
+	if from, to, isRange := strings.Cut(spec, "-"); isRange {
+		low, err1 := strconv.Atoi(strings.TrimSpace(from))
+		high, err2 := strconv.Atoi(strings.TrimSpace(to))
+		if err1 != nil || err2 != nil {
+			fmt.Println("Invalid status code range:", spec)
+			return false
+		}
+		return status >= low && status <= high
+	}
+
+	code, err := strconv.Atoi(spec)
+	if err != nil {
+		fmt.Println("Invalid status code:", spec)
+		return false
+	}
+	return status == code
+}
@@ -8,7 +8,7 @@ import (
 func TestMatchesResponseConditions_Nil(t *testing.T) {
 	t.Parallel()
 	h := http.Header{}
-	if !matchesResponseConditions(404, h, nil) {
+	if !matchesResponseConditions(404, h, true, nil) {
 		t.Fatalf("nil conditions should allow any status/headers")
 	}
 }
@@ -18,10 +18,10 @@ func TestMatchesResponseConditions_StatusOnly(t *testing.T) {
 	rc := &ResponseConditions{TrackOnStatusCodes: []int{200, 201}}
 	h := http.Header{}
 
-	if !matchesResponseConditions(200, h, rc) {
+	if !matchesResponseConditions(200, h, true, rc) {
 		t.Fatalf("expected status 200 to match")
 	}
-	if matchesResponseConditions(404, h, rc) {
+	if matchesResponseConditions(404, h, true, rc) {
 		t.Fatalf("expected status 404 to NOT match")
 	}
 }
@@ -39,14 +39,14 @@ func TestMatchesResponseConditions_HeadersOnly(t *testing.T) {
 	// Match exact value
 	h := http.Header{}
 	h.Set("content-type", "text/html; charset=UTF-8") // mixed case set
-	if !matchesResponseConditions(200, h, rc) {
+	if !matchesResponseConditions(200, h, true, rc) {
 		t.Fatalf("expected header to match")
 	}
 
 	// Non-matching value
 	h2 := http.Header{}
 	h2.Set("Content-Type", "application/json")
-	if matchesResponseConditions(200, h2, rc) {
+	if matchesResponseConditions(200, h2, true, rc) {
 		t.Fatalf("expected header to NOT match")
 	}
 
@@ -54,7 +54,7 @@ func TestMatchesResponseConditions_HeadersOnly(t *testing.T) {
 	h3 := http.Header{}
 	h3.Add("Content-Type", "application/json")
 	h3.Add("Content-Type", "text/html; charset=UTF-8")
-	if !matchesResponseConditions(200, h3, rc) {
+	if !matchesResponseConditions(200, h3, true, rc) {
 		t.Fatalf("expected one-of multiple header values to match")
 	}
 }
@@ -74,19 +74,19 @@ func TestMatchesResponseConditions_BothStatusAndHeaders(t *testing.T) {
 	h := http.Header{}
 	h.Set("X-App", "web")
 	h.Set("Content-Type", "text/html")
-	if !matchesResponseConditions(200, h, rc) {
+	if !matchesResponseConditions(200, h, true, rc) {
 		t.Fatalf("expected combined conditions to match")
 	}
 
 	// Status mismatch
-	if matchesResponseConditions(404, h, rc) {
+	if matchesResponseConditions(404, h, true, rc) {
 		t.Fatalf("expected status mismatch to fail")
 	}
 
 	// Header missing
 	hMissing := http.Header{}
 	hMissing.Set("X-App", "web")
-	if matchesResponseConditions(200, hMissing, rc) {
+	if matchesResponseConditions(200, hMissing, true, rc) {
 		t.Fatalf("expected missing header to fail")
 	}
 
@@ -94,7 +94,131 @@ func TestMatchesResponseConditions_BothStatusAndHeaders(t *testing.T) {
 	hDiff := http.Header{}
 	hDiff.Set("X-App", "api")
 	hDiff.Set("Content-Type", "text/html")
-	if matchesResponseConditions(200, hDiff, rc) {
+	if matchesResponseConditions(200, hDiff, true, rc) {
 		t.Fatalf("expected header value mismatch to fail")
 	}
 }
+
+func TestMatchesStatusSpec(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		status int
+		spec   string
+		want   bool
+	}{
+		{200, "200", true},
+		{201, "200", false},
+		{204, "2xx", true},
+		{204, "2XX", true},
+		{301, "2xx", false},
+		{404, "400-499", true},
+		{500, "400-499", false},
+		{404, " 404 ", true},
+		{404, "abc", false},
+		{404, "4x", false},
+		{404, "a-b", false},
+	}
+	for _, tc := range cases {
+		if got := matchesStatusSpec(tc.status, tc.spec); got != tc.want {
+			t.Fatalf("matchesStatusSpec(%d, %q) = %v; want %v", tc.status, tc.spec, got, tc.want)
+		}
+	}
+}
+
+func TestMatchesResponseConditions_StatusSpecs(t *testing.T) {
+	t.Parallel()
+
+	rc := &ResponseConditions{
+		StatusCodes:    []string{"2xx", "300-304"},
+		NotStatusCodes: []string{"204"},
+	}
+	h := http.Header{}
+
+	for status, want := range map[int]bool{200: true, 204: false, 302: true, 307: false, 404: false} {
+		if got := matchesResponseConditions(status, h, true, rc); got != want {
+			t.Fatalf("status %d: got %v; want %v", status, got, want)
+		}
+	}
+
+	// Legacy exact codes and new specs are ANDed
+	rc = &ResponseConditions{TrackOnStatusCodes: []int{200, 404}, StatusCodes: []string{"2xx"}}
+	if !matchesResponseConditions(200, h, true, rc) || matchesResponseConditions(404, h, true, rc) {
+		t.Fatalf("expected TrackOnStatusCodes and StatusCodes to be ANDed")
+	}
+}
+
+func TestMatchesResponseConditions_Groups(t *testing.T) {
+	t.Parallel()
+
+	// Track HTML pages with 2xx, or any 404, but never responses marked as private
+	rc := &ResponseConditions{
+		AnyOf: []ResponseConditions{
+			{
+				StatusCodes:      []string{"2xx"},
+				TrackWhenHeaders: map[string]string{"Content-Type": "text/html"},
+			},
+			{StatusCodes: []string{"404"}},
+		},
+		Not: &ResponseConditions{TrackWhenHeaders: map[string]string{"Cache-Control": "private"}},
+	}
+
+	html := http.Header{}
+	html.Set("Content-Type", "text/html")
+	json := http.Header{}
+	json.Set("Content-Type", "application/json")
+	private := http.Header{}
+	private.Set("Content-Type", "text/html")
+	private.Set("Cache-Control", "private")
+
+	cases := []struct {
+		name   string
+		status int
+		hdr    http.Header
+		want   bool
+	}{
+		{"html 200", 200, html, true},
+		{"json 200", 200, json, false},
+		{"json 404", 404, json, true},
+		{"html 500", 500, html, false},
+		{"private html", 200, private, false},
+	}
+	for _, tc := range cases {
+		if got := matchesResponseConditions(tc.status, tc.hdr, true, rc); got != tc.want {
+			t.Fatalf("%s: got %v; want %v", tc.name, got, tc.want)
+		}
+	}
+
+	// allOf requires every nested condition
+	all := &ResponseConditions{AllOf: []ResponseConditions{
+		{StatusCodes: []string{"2xx"}},
+		{NotStatusCodes: []string{"204"}},
+	}}
+	if !matchesResponseConditions(200, html, true, all) || matchesResponseConditions(204, html, true, all) {
+		t.Fatalf("allOf evaluated incorrectly")
+	}
+}
+
+func TestMatchesResponseConditions_HeaderMatchers(t *testing.T) {
+	t.Parallel()
+
+	rc := &ResponseConditions{
+		Headers: map[string]ValueMatcher{
+			"Content-Type":   {MediaType: "text/html"},
+			"X-Robots-Tag":   {Absent: true},
+			"Content-Length": {Present: true},
+		},
+	}
+
+	h := http.Header{}
+	h.Set("content-type", "text/html;charset=utf-8")
+	h.Set("Content-Length", "42")
+	if !matchesResponseConditions(200, h, true, rc) {
+		t.Fatalf("expected header matchers to match")
+	}
+
+	h.Set("X-Robots-Tag", "noindex")
+	if matchesResponseConditions(200, h, true, rc) {
+		t.Fatalf("expected absent matcher to fail")
+	}
+}
@@ -0,0 +1,170 @@
+package MatomoTracking
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// statusRecorder captures the final status while delegating to the real ResponseWriter.
+// It implements http.Flusher (and FlushError), http.Hijacker and io.ReaderFrom
+// by forwarding to the underlying writer, and Unwrap for http.ResponseController.
+// Response headers starting with stripPrefix or named in stripNames are moved
+// into captured before the headers are sent, so they never reach the client.
+type statusRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	stripPrefix string
+	stripNames  []string
+	captured    http.Header
+	start       time.Time // handler invoked
+	firstByte   time.Time // final header written
+	end         time.Time // handler returned
+	bytes       int64     // response body bytes written
+	hijacked    bool      // connection taken over by the handler
+	onHeader    func()    // called once the final header has been written
+	abortReason string    // why the response did not complete, "" if it did
+}
+
+func newStatusRecorder(w http.ResponseWriter) *statusRecorder {
+	// Default to 200 unless WriteHeader is called explicitly.
+	return &statusRecorder{ResponseWriter: w, status: http.StatusOK, captured: http.Header{}, start: time.Now()}
+}
+
+func (w *statusRecorder) WriteHeader(code int) {
+	w.captureHeaders()
+	// Informational (1xx) responses may be followed by the final header
+	first := code >= 200 && !w.wroteHeader
+	if first {
+		w.wroteHeader = true
+		w.firstByte = time.Now()
+	}
+	w.status = code
+	w.ResponseWriter.WriteHeader(code)
+	if first && w.onHeader != nil {
+		w.onHeader()
+	}
+}
+
+func (w *statusRecorder) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.bytes += int64(n)
+	if err != nil {
+		w.abort(abortWriteError)
+	}
+	return n, err
+}
+
+// abort records the first reason why the response did not complete.
+func (w *statusRecorder) abort(reason string) {
+	if w.abortReason == "" {
+		w.abortReason = reason
+	}
+}
+
+// finish captures headers the handler set without writing a response;
+// net/http sends them only after the middleware has returned.
+func (w *statusRecorder) finish() {
+	w.end = time.Now()
+	if !w.wroteHeader {
+		w.captureHeaders()
+		w.firstByte = w.end
+	}
+}
+
+func (w *statusRecorder) captureHeaders() {
+	if w.stripPrefix == "" && len(w.stripNames) == 0 {
+		return
+	}
+	prefix := strings.ToLower(w.stripPrefix)
+	hdr := w.ResponseWriter.Header()
+	for k, v := range hdr {
+		if (prefix != "" && strings.HasPrefix(strings.ToLower(k), prefix)) || w.isStripName(k) {
+			w.captured[http.CanonicalHeaderKey(k)] = v
+			delete(hdr, k)
+		}
+	}
+}
+
+func (w *statusRecorder) isStripName(key string) bool {
+	for _, name := range w.stripNames {
+		if strings.EqualFold(name, key) {
+			return true
+		}
+	}
+	return false
+}
+
+// Flush sends buffered data to the client, e.g. for server-sent events.
+func (w *statusRecorder) Flush() {
+	w.FlushError()
+}
+
+// FlushError is Flush with an error result, used by http.ResponseController.
+// It returns http.ErrNotSupported if the underlying writer cannot flush.
+func (w *statusRecorder) FlushError() error {
+	switch f := w.ResponseWriter.(type) {
+	case interface{ FlushError() error }:
+		if !w.wroteHeader {
+			w.WriteHeader(http.StatusOK)
+		}
+		return f.FlushError()
+	case http.Flusher:
+		if !w.wroteHeader {
+			w.WriteHeader(http.StatusOK)
+		}
+		f.Flush()
+		return nil
+	default:
+		return http.ErrNotSupported
+	}
+}
+
+// Hijack lets the handler take over the connection, e.g. for WebSockets.
+// A hijacked connection without a final header counts as 101 Switching Protocols.
+func (w *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("%T: %w", w.ResponseWriter, http.ErrNotSupported)
+	}
+	conn, rw, err := h.Hijack()
+	if err != nil {
+		return nil, nil, err
+	}
+	w.hijacked = true
+	if !w.wroteHeader {
+		w.status = http.StatusSwitchingProtocols
+	}
+	return conn, rw, nil
+}
+
+// ReadFrom copies the body from r, using the underlying writer's ReadFrom
+// (e.g. sendfile) when available.
+func (w *statusRecorder) ReadFrom(r io.Reader) (int64, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if rf, ok := w.ResponseWriter.(io.ReaderFrom); ok {
+		n, err := rf.ReadFrom(r)
+		w.bytes += n
+		if err != nil {
+			w.abort(abortWriteError)
+		}
+		return n, err
+	}
+	// Hide ReadFrom so io.Copy does not call it again; Write counts the bytes.
+	return io.Copy(struct{ io.Writer }{w}, r)
+}
+
+// Unwrap returns the underlying writer for http.ResponseController.
+func (w *statusRecorder) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,207 @@
+package MatomoTracking
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestStatusRecorder_Flush(t *testing.T) {
+	t.Parallel()
+
+	inner := httptest.NewRecorder()
+	rec := newStatusRecorder(inner)
+	rec.Header().Set("X-Matomo-Track", "0")
+	rec.stripPrefix = "X-Matomo-"
+	http.NewResponseController(rec).Flush()
+	if !inner.Flushed || !rec.wroteHeader || rec.status != http.StatusOK {
+		t.Fatalf("flush not forwarded: flushed=%v wroteHeader=%v status=%d", inner.Flushed, rec.wroteHeader, rec.status)
+	}
+	if inner.Header().Get("X-Matomo-Track") != "" || rec.captured.Get("X-Matomo-Track") != "0" {
+		t.Fatalf("control header not captured before flush")
+	}
+}
+
+func TestStatusRecorder_FlushUnsupported(t *testing.T) {
+	t.Parallel()
+
+	// Hides the recorder's Flush method
+	inner := struct{ http.ResponseWriter }{httptest.NewRecorder()}
+	rec := newStatusRecorder(inner)
+	if err := http.NewResponseController(rec).Flush(); !errors.Is(err, http.ErrNotSupported) {
+		t.Fatalf("Flush() error = %v; want http.ErrNotSupported", err)
+	}
+	if rec.wroteHeader {
+		t.Fatalf("unsupported flush must not write the header")
+	}
+}
+
+func TestStatusRecorder_ReadFrom(t *testing.T) {
+	t.Parallel()
+
+	inner := httptest.NewRecorder()
+	rec := newStatusRecorder(inner)
+	n, err := rec.ReadFrom(strings.NewReader("streamed body"))
+	if err != nil || n != 13 {
+		t.Fatalf("ReadFrom() = %d, %v; want 13, nil", n, err)
+	}
+	if rec.bytes != 13 || inner.Body.String() != "streamed body" {
+		t.Fatalf("bytes = %d, body = %q", rec.bytes, inner.Body.String())
+	}
+}
+
+func TestStatusRecorder_UnwrapAndHijackUnsupported(t *testing.T) {
+	t.Parallel()
+
+	inner := httptest.NewRecorder()
+	rec := newStatusRecorder(inner)
+	if rec.Unwrap() != http.ResponseWriter(inner) {
+		t.Fatalf("Unwrap() did not return the underlying writer")
+	}
+	if _, _, err := rec.Hijack(); !errors.Is(err, http.ErrNotSupported) {
+		t.Fatalf("Hijack() on a non-hijackable writer = %v, want http.ErrNotSupported", err)
+	}
+	if _, _, err := http.NewResponseController(rec).Hijack(); !errors.Is(err, http.ErrNotSupported) {
+		t.Fatalf("ResponseController.Hijack() = %v, want http.ErrNotSupported", err)
+	}
+	if rec.hijacked {
+		t.Fatalf("failed hijack must not mark the recorder")
+	}
+}
+
+// upgradeServer serves the middleware in front of a handler that hijacks the
+// connection and answers with 101 Switching Protocols.
+func upgradeServer(t *testing.T, matomoURL string, mode string) string {
+	t.Helper()
+	cfg := &Config{
+		MatomoURL: matomoURL,
+		Domains: map[string]DomainConfig{
+			"example.com": {TrackingEnabled: true, IdSite: 1, UpgradeTracking: mode},
+		},
+	}
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, brw, err := http.NewResponseController(w).Hijack()
+		if err != nil {
+			t.Errorf("Hijack() error = %v", err)
+			return
+		}
+		defer conn.Close()
+		brw.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n\r\n")
+		brw.Flush()
+	})
+	h, err := New(context.Background(), next, cfg, "test")
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+	return srv.Listener.Addr().String()
+}
+
+func dialUpgrade(t *testing.T, addr string) {
+	t.Helper()
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+	conn.Write([]byte("GET /ws HTTP/1.1\r\nHost: example.com\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n\r\n"))
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		t.Fatalf("read response: %v", err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("status = %d; want 101", resp.StatusCode)
+	}
+}
+
+func TestServeHTTP_UpgradeTracking(t *testing.T) {
+	t.Parallel()
+
+	matomoURL, hits := startHitCollector(t)
+	dialUpgrade(t, upgradeServer(t, matomoURL, ""))
+	expectNoHit(t, hits)
+
+	dialUpgrade(t, upgradeServer(t, matomoURL, upgradeEvent))
+	q := expectHit(t, hits).URL.Query()
+	if q.Get("e_c") != "Upgrade" || q.Get("e_a") != "websocket" || q.Get("e_n") != "/ws" {
+		t.Fatalf("unexpected event params: %v", q)
+	}
+	if q.Get("bw_bytes") != "" || q.Get("pf_srv") != "" {
+		t.Fatalf("performance params sent for upgraded connection: %v", q)
+	}
+}
+
+func TestStatusRecorder_OnHeaderOnce(t *testing.T) {
+	t.Parallel()
+
+	rec := newStatusRecorder(httptest.NewRecorder())
+	calls := 0
+	rec.onHeader = func() { calls++ }
+	rec.WriteHeader(http.StatusEarlyHints)
+	if calls != 0 {
+		t.Fatalf("onHeader called for informational status")
+	}
+	rec.Write([]byte("a"))
+	rec.WriteHeader(http.StatusInternalServerError)
+	rec.Write([]byte("b"))
+	if calls != 1 {
+		t.Fatalf("onHeader called %d times; want 1", calls)
+	}
+}
+
+func TestServeHTTP_TrackAtHeaders(t *testing.T) {
+	t.Parallel()
+
+	matomoURL, hits := startHitCollector(t)
+	cfg := &Config{
+		MatomoURL: matomoURL,
+		Domains: map[string]DomainConfig{
+			"example.com": {
+				TrackingEnabled:    true,
+				IdSite:             1,
+				TrackAt:            trackAtHeaders,
+				ResponseConditions: &ResponseConditions{StatusCodes: []string{"2xx"}},
+			},
+		},
+	}
+	release := make(chan struct{})
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte("data: hello\n\n"))
+		<-release // keep streaming until the hit has been observed
+	})
+	h, err := New(context.Background(), next, cfg, "test")
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		req := httptest.NewRequest(http.MethodGet, "http://example.com/stream", nil)
+		req.RemoteAddr = "203.0.113.9:54321"
+		h.ServeHTTP(httptest.NewRecorder(), req)
+	}()
+	q := expectHit(t, hits).URL.Query()
+	close(release)
+	<-done
+	if q.Get("pf_srv") == "" || q.Get("bw_bytes") != "" {
+		t.Fatalf("unexpected performance params: %v", q)
+	}
+	expectNoHit(t, hits) // decided only once
+
+	req := httptest.NewRequest(http.MethodGet, "http://example.com/missing", nil)
+	req.RemoteAddr = "203.0.113.9:54321"
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	expectNoHit(t, hits)
+}
@@ -0,0 +1,80 @@
+package MatomoTracking
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// RewriteRule rewrites the tracked URL path and sets the action name.
+// Either Match or Route is used; the first matching rule wins.
+type RewriteRule struct {
+	// Match is a regex on the request path.
+	Match string `json:"match,omitempty"`
+	// Route is a route template such as "/orders/{id}"; each {name} matches one path segment.
+	Route string `json:"route,omitempty"`
+	// Replace replaces every match in the path (regexp.ReplaceAllString); the
+	// rest of the path is kept. Captures can be used as $1 or ${name}.
+	// Empty = the route template itself for Route rules, the unchanged path for Match rules.
+	Replace string `json:"replace,omitempty"`
+	// ActionName is the action name template. Captures can be used as $1 or ${name}. Empty = unchanged.
+	ActionName string `json:"actionName,omitempty"`
+}
+
+var routeParam = regexp.MustCompile(`\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// routePattern converts a route template into an anchored regex with one
+// named group per {name} placeholder.
+func routePattern(route string) string {
+	var b strings.Builder
+	b.WriteString("^")
+	last := 0
+	for _, loc := range routeParam.FindAllStringSubmatchIndex(route, -1) {
+		b.WriteString(regexp.QuoteMeta(route[last:loc[0]]))
+		b.WriteString("(?P<" + route[loc[2]:loc[3]] + ">[^/]+)")
+		last = loc[1]
+	}
+	b.WriteString(regexp.QuoteMeta(route[last:]))
+	b.WriteString("$")
+	return b.String()
+}
+
+// rewritePath applies the first matching rule to path. It returns the tracked
+// path and the action name ("" = unchanged).
+func rewritePath(path string, rules []RewriteRule) (string, string) {
+	for _, rule := range rules {
+		pattern := rule.Match
+		replace := rule.Replace
+		if rule.Route != "" {
+			pattern = routePattern(rule.Route)
+			if replace == "" {
+				replace = rule.Route
+			}
+		}
+		if pattern == "" {
+			continue
+		}
+		re, err := cachedRegexp(pattern)
+		if err != nil {
+			fmt.Println("Error compiling rewrite rule:", err)
+			continue
+		}
+		match := re.FindStringSubmatchIndex(path)
+		if match == nil {
+			continue
+		}
+
+		// Like regexp.ReplaceAllString: only the matched part is replaced
+		rewritten := path
+		if replace != "" {
+			rewritten = re.ReplaceAllString(path, replace)
+		}
+		actionName := ""
+		if rule.ActionName != "" {
+			actionName = string(re.ExpandString(nil, rule.ActionName, path, match))
+		}
+		fmt.Printf("Rewriting tracked path %s to %s\n", path, rewritten)
+		return rewritten, actionName
+	}
+	return path, ""
+}
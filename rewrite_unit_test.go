@@ -0,0 +1,79 @@
+package MatomoTracking
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRoutePattern(t *testing.T) {
+	t.Parallel()
+
+	if got, want := routePattern("/orders/{id}.json"), `^/orders/(?P<id>[^/]+)\.json$`; got != want {
+		t.Fatalf("routePattern() = %q; want %q", got, want)
+	}
+}
+
+func TestRewritePath(t *testing.T) {
+	t.Parallel()
+
+	rules := []RewriteRule{
+		{Match: `(`}, // invalid regex is skipped
+		{Route: "/orders/{id}", ActionName: "Orders / Detail"},
+		{Route: "/users/{user}/repos/{repo}", Replace: "/users/_/repos/${repo}", ActionName: "Repo ${repo}"},
+		{Match: `^/articles/\d+-(.+)$`, Replace: "/articles/$1", ActionName: "Article"},
+		{Match: `^/search`, ActionName: "Search"},
+		{Match: `/products/\d+`, Replace: "/products/id", ActionName: "Product"},
+	}
+	cases := []struct {
+		path       string
+		wantPath   string
+		wantAction string
+	}{
+		{"/orders/84213", "/orders/{id}", "Orders / Detail"},
+		{"/orders/84213/items", "/orders/84213/items", ""},
+		{"/users/jane/repos/tools", "/users/_/repos/tools", "Repo tools"},
+		{"/articles/12-hello-world", "/articles/hello-world", "Article"},
+		{"/search/results", "/search/results", "Search"},
+		{"/about", "/about", ""},
+		{"/products/123/reviews", "/products/id/reviews", "Product"},
+		{"/shop/products/7", "/shop/products/id", "Product"},
+	}
+	for _, tc := range cases {
+		gotPath, gotAction := rewritePath(tc.path, rules)
+		if gotPath != tc.wantPath || gotAction != tc.wantAction {
+			t.Fatalf("rewritePath(%q) = %q, %q; want %q, %q", tc.path, gotPath, gotAction, tc.wantPath, tc.wantAction)
+		}
+	}
+}
+
+func TestServeHTTP_RewritePathOverride(t *testing.T) {
+	t.Parallel()
+
+	matomoURL, hits := startHitCollector(t)
+	cfg := &Config{
+		MatomoURL: matomoURL,
+		Domains: map[string]DomainConfig{
+			"example.com": {
+				TrackingEnabled: true,
+				IdSite:          1,
+				PathOverrides: map[string]PathConfig{
+					"/orders": {Rewrite: []RewriteRule{{Route: "/orders/{id}", Replace: "/orders/detail", ActionName: "Orders / Detail"}}},
+				},
+			},
+		},
+	}
+	h, err := New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}), cfg, "test")
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "http://example.com/orders/84213?tab=items", nil)
+	req.RemoteAddr = "203.0.113.9:54321"
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	q := expectHit(t, hits).URL.Query()
+	if q.Get("url") != "http://example.com/orders/detail?tab=items" || q.Get("action_name") != "Orders / Detail" {
+		t.Fatalf("unexpected rewrite params: %v", q)
+	}
+}
@@ -0,0 +1,168 @@
+package MatomoTracking
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// defaultTCFCookie is the cookie IAB TCF v2 CMPs store the TC string in.
+const defaultTCFCookie = "euconsent-v2"
+
+// defaultTCFPurposes are the purposes required when TCFConfig.Purposes is empty:
+// 1 (store and/or access information on a device) and 8 (measure content performance).
+var defaultTCFPurposes = []int{1, 8}
+
+// TCFConfig gates tracking on an IAB TCF v2 consent string.
+type TCFConfig struct {
+	// Cookie holding the TC string. Empty = "euconsent-v2".
+	Cookie string `json:"cookie,omitempty"`
+	// Purposes that must all have consent. Empty = 1 and 8.
+	Purposes []int `json:"purposes,omitempty"`
+	// VendorID that must have consent as well. 0 = not checked.
+	VendorID int `json:"vendorId,omitempty"`
+}
+
+// tcString holds the parts of a decoded TC string core segment needed for consent checks.
+type tcString struct {
+	version         int
+	purposeConsents []bool // index 0 = purpose 1
+	vendorConsent   bool   // consent for the vendor passed to decodeTCString
+}
+
+// tcfConsentGranted returns true if the request carries a TC string granting
+// all required purposes (and the vendor, if configured). Missing or
+// undecodable strings count as no consent.
+func tcfConsentGranted(req *http.Request, tc *TCFConfig) bool {
+	name := tc.Cookie
+	if name == "" {
+		name = defaultTCFCookie
+	}
+	cookie, err := req.Cookie(name)
+	if err != nil || cookie.Value == "" {
+		return false
+	}
+
+	decoded, err := decodeTCString(cookie.Value, tc.VendorID)
+	if err != nil {
+		fmt.Println("Error decoding TC string:", err)
+		return false
+	}
+
+	purposes := tc.Purposes
+	if len(purposes) == 0 {
+		purposes = defaultTCFPurposes
+	}
+	for _, p := range purposes {
+		if p < 1 || p > len(decoded.purposeConsents) || !decoded.purposeConsents[p-1] {
+			fmt.Println("TC string lacks consent for purpose:", p)
+			return false
+		}
+	}
+
+	if tc.VendorID > 0 && !decoded.vendorConsent {
+		fmt.Println("TC string lacks consent for vendor:", tc.VendorID)
+		return false
+	}
+	return true
+}
+
+// decodeTCString parses the core segment of an IAB TCF v2 TC string. The
+// vendor section is only read if vendorID > 0, and only the consent for that
+// vendor is kept: ranges are checked as they are read, never expanded, since
+// the string comes from an untrusted cookie.
+func decodeTCString(value string, vendorID int) (*tcString, error) {
+	// Segments are separated by dots; the core segment always comes first
+	core := strings.SplitN(strings.TrimSpace(value), ".", 2)[0]
+	data, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(core, "="))
+	if err != nil {
+		return nil, err
+	}
+
+	r := &bitReader{data: data}
+	tc := &tcString{}
+
+	tc.version = r.readInt(6)
+	if r.err == nil && tc.version != 2 {
+		return nil, fmt.Errorf("unsupported TC string version %d", tc.version)
+	}
+	r.skip(36 + 36 + 12 + 12 + 6 + 12 + 12 + 6 + 1 + 1 + 12) // Created .. SpecialFeatureOptIns
+
+	tc.purposeConsents = make([]bool, 24)
+	for i := range tc.purposeConsents {
+		tc.purposeConsents[i] = r.readBool()
+	}
+	r.skip(24 + 1 + 12) // PurposesLITransparency, PurposeOneTreatment, PublisherCC
+
+	if vendorID > 0 && r.err == nil {
+		// Vendor consent section
+		maxVendorID := r.readInt(16)
+		if r.readBool() {
+			// Range encoding
+			numEntries := r.readInt(12)
+			for i := 0; i < numEntries && r.err == nil; i++ {
+				isRange := r.readBool()
+				start := r.readInt(16)
+				end := start
+				if isRange {
+					end = r.readInt(16)
+				}
+				if end < start || end > maxVendorID {
+					return nil, errors.New("invalid vendor range in TC string")
+				}
+				if vendorID >= start && vendorID <= end {
+					tc.vendorConsent = true
+				}
+			}
+		} else if vendorID <= maxVendorID {
+			// Bit field encoding, one bit per vendor starting at ID 1
+			r.skip(vendorID - 1)
+			tc.vendorConsent = r.readBool()
+		}
+	}
+
+	if r.err != nil {
+		return nil, r.err
+	}
+	return tc, nil
+}
+
+// bitReader reads big-endian bit fields from a byte slice. The first read
+// past the end sets err; subsequent reads return zero.
+type bitReader struct {
+	data []byte
+	pos  int
+	err  error
+}
+
+func (r *bitReader) readInt(bits int) int {
+	v := 0
+	for i := 0; i < bits; i++ {
+		v <<= 1
+		if r.readBool() {
+			v |= 1
+		}
+	}
+	return v
+}
+
+func (r *bitReader) readBool() bool {
+	if r.err != nil {
+		return false
+	}
+	if r.pos >= len(r.data)*8 {
+		r.err = errors.New("TC string too short")
+		return false
+	}
+	bit := r.data[r.pos/8]&(0x80>>(r.pos%8)) != 0
+	r.pos++
+	return bit
+}
+
+func (r *bitReader) skip(bits int) {
+	for i := 0; i < bits; i++ {
+		r.readBool()
+	}
+}
@@ -0,0 +1,182 @@
+package MatomoTracking
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// bitWriter builds TC strings for tests.
+type bitWriter struct {
+	bits []bool
+}
+
+func (w *bitWriter) writeInt(v, bits int) {
+	for i := bits - 1; i >= 0; i-- {
+		w.bits = append(w.bits, v&(1<<i) != 0)
+	}
+}
+
+func (w *bitWriter) encode() string {
+	data := make([]byte, (len(w.bits)+7)/8)
+	for i, b := range w.bits {
+		if b {
+			data[i/8] |= 0x80 >> (i % 8)
+		}
+	}
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// buildTCString encodes a v2 core segment granting the given purposes and vendors.
+func buildTCString(purposes []int, vendors []int, rangeEncoding bool) string {
+	w := &bitWriter{}
+	w.writeInt(2, 6)                            // Version
+	w.writeInt(0, 36+36+12+12+6+12+12+6+1+1+12) // Created .. SpecialFeatureOptIns
+	granted := map[int]bool{}
+	for _, p := range purposes {
+		granted[p] = true
+	}
+	for p := 1; p <= 24; p++ {
+		if granted[p] {
+			w.writeInt(1, 1)
+		} else {
+			w.writeInt(0, 1)
+		}
+	}
+	w.writeInt(0, 24+1+12) // PurposesLITransparency, PurposeOneTreatment, PublisherCC
+
+	maxVendor := 0
+	for _, v := range vendors {
+		if v > maxVendor {
+			maxVendor = v
+		}
+	}
+	w.writeInt(maxVendor, 16)
+	if rangeEncoding {
+		w.writeInt(1, 1)
+		w.writeInt(len(vendors), 12)
+		for _, v := range vendors {
+			w.writeInt(0, 1)
+			w.writeInt(v, 16)
+		}
+	} else {
+		w.writeInt(0, 1)
+		consented := map[int]bool{}
+		for _, v := range vendors {
+			consented[v] = true
+		}
+		for id := 1; id <= maxVendor; id++ {
+			if consented[id] {
+				w.writeInt(1, 1)
+			} else {
+				w.writeInt(0, 1)
+			}
+		}
+	}
+	return w.encode()
+}
+
+func TestDecodeTCString(t *testing.T) {
+	t.Parallel()
+
+	for _, rangeEncoding := range []bool{false, true} {
+		value := buildTCString([]int{1, 8}, []int{3, 755}, rangeEncoding) + ".YAAAAAAAAAAA"
+		for vendorID, want := range map[int]bool{0: false, 3: true, 4: false, 755: true, 756: false} {
+			tc, err := decodeTCString(value, vendorID)
+			if err != nil {
+				t.Fatalf("decodeTCString() error = %v", err)
+			}
+			if tc.version != 2 {
+				t.Fatalf("version = %d; want 2", tc.version)
+			}
+			if !tc.purposeConsents[0] || !tc.purposeConsents[7] || tc.purposeConsents[1] {
+				t.Fatalf("purposeConsents = %v; want only 1 and 8", tc.purposeConsents)
+			}
+			if tc.vendorConsent != want {
+				t.Fatalf("vendor %d consent = %v; want %v (range=%v)", vendorID, tc.vendorConsent, want, rangeEncoding)
+			}
+		}
+	}
+
+	for _, bad := range []string{"", "!!!", "AAAA", buildTCString(nil, nil, false)[:20]} {
+		if _, err := decodeTCString(bad, 0); err == nil {
+			t.Fatalf("decodeTCString(%q) succeeded; want error", bad)
+		}
+	}
+}
+
+// Huge vendor ranges must not be expanded.
+func TestDecodeTCString_LargeRanges(t *testing.T) {
+	t.Parallel()
+
+	w := &bitWriter{}
+	w.writeInt(2, 6)
+	w.writeInt(0, 36+36+12+12+6+12+12+6+1+1+12)
+	w.writeInt(0, 24+24+1+12)
+	w.writeInt(65535, 16) // MaxVendorId
+	w.writeInt(1, 1)      // range encoding
+	w.writeInt(4095, 12)
+	for i := 0; i < 4095; i++ {
+		w.writeInt(1, 1)
+		w.writeInt(1, 16)
+		w.writeInt(65535, 16)
+	}
+
+	start := time.Now()
+	tc, err := decodeTCString(w.encode(), 755)
+	if err != nil || !tc.vendorConsent {
+		t.Fatalf("decodeTCString() = %+v, %v; want vendor consent", tc, err)
+	}
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Fatalf("decodeTCString() took %v", elapsed)
+	}
+}
+
+func TestTCFConsentGranted(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name   string
+		tc     *TCFConfig
+		cookie string
+		want   bool
+	}{
+		{"default purposes granted", &TCFConfig{}, buildTCString([]int{1, 8}, nil, false), true},
+		{"default purposes missing 8", &TCFConfig{}, buildTCString([]int{1}, nil, false), false},
+		{"custom purposes", &TCFConfig{Purposes: []int{1, 9, 10}}, buildTCString([]int{1, 9, 10}, nil, false), true},
+		{"vendor granted", &TCFConfig{VendorID: 755}, buildTCString([]int{1, 8}, []int{755}, true), true},
+		{"vendor missing", &TCFConfig{VendorID: 755}, buildTCString([]int{1, 8}, []int{3}, false), false},
+		{"invalid string", &TCFConfig{}, "not-a-tc-string", false},
+		{"no cookie", &TCFConfig{}, "", false},
+	}
+
+	for _, tc := range cases {
+		req := httptest.NewRequest(http.MethodGet, "http://example.com/", nil)
+		if tc.cookie != "" {
+			req.AddCookie(&http.Cookie{Name: defaultTCFCookie, Value: tc.cookie})
+		}
+		if got := tcfConsentGranted(req, tc.tc); got != tc.want {
+			t.Fatalf("%s: tcfConsentGranted() = %v; want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestConsentMode_TCF(t *testing.T) {
+	t.Parallel()
+
+	cc := &ConsentConfig{TCF: &TCFConfig{Cookie: "tc"}, OnMissing: "cookieless"}
+
+	req := httptest.NewRequest(http.MethodGet, "http://example.com/", nil)
+	req.AddCookie(&http.Cookie{Name: "tc", Value: buildTCString([]int{1, 8}, nil, false)})
+	if got := consentMode(req, cc); got != consentFull {
+		t.Fatalf("consentMode() = %q; want full consent", got)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "http://example.com/", nil)
+	req.AddCookie(&http.Cookie{Name: "tc", Value: "garbage"})
+	if got := consentMode(req, cc); got != consentCookieless {
+		t.Fatalf("consentMode() = %q; want cookieless fallback", got)
+	}
+}
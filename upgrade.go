@@ -0,0 +1,50 @@
+package MatomoTracking
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// Upgrade tracking modes.
+const (
+	upgradeSkip     = "skip"
+	upgradePageview = "pageview"
+	upgradeEvent    = "event"
+)
+
+// isUpgraded reports whether the handler switched protocols or took over the connection.
+func isUpgraded(rec *statusRecorder) bool {
+	return rec.hijacked || rec.status == http.StatusSwitchingProtocols
+}
+
+// applyUpgradeTracking returns false if an upgraded (e.g. WebSocket) or hijacked
+// connection must not be tracked. Mode "event" records it as an event
+// (category "Upgrade", action = protocol, name = path). Other responses are not affected.
+func applyUpgradeTracking(req *http.Request, rec *statusRecorder, mode string, hit *trackingHit) bool {
+	if !isUpgraded(rec) {
+		return true
+	}
+
+	// Timings and size of a long-lived connection say nothing about the page
+	for _, key := range []string{"pf_srv", "pf_tfr", "bw_bytes"} {
+		hit.params.Del(key)
+	}
+
+	switch mode {
+	case "", upgradeSkip:
+		fmt.Println("Upgraded connection not tracked:", req.URL.Path)
+		return false
+	case upgradePageview:
+		return true
+	case upgradeEvent:
+		protocol := req.Header.Get("Upgrade")
+		if protocol == "" {
+			protocol = "hijacked"
+		}
+		hit.setEvent("Upgrade", protocol, req.URL.Path)
+		return true
+	default:
+		fmt.Println("Unknown upgrade tracking mode:", mode)
+		return false
+	}
+}
@@ -0,0 +1,108 @@
+package MatomoTracking
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// User ID sources.
+const (
+	userIDHeader = "header"
+	userIDCookie = "cookie"
+	userIDJWT    = "jwt"
+)
+
+// UserIDConfig defines where the Matomo user ID (uid) of a signed-in user is read from.
+type UserIDConfig struct {
+	// Source is header, cookie or jwt.
+	Source string `json:"source,omitempty"`
+	// Name of the header or cookie. For jwt, the cookie holding the token;
+	// empty = bearer token from the Authorization header.
+	Name string `json:"name,omitempty"`
+	// Claim is the dot-separated path of the JWT claim (default "sub").
+	Claim string `json:"claim,omitempty"`
+	// HashKey enables HMAC-SHA256 of the user ID with this key before it is sent.
+	HashKey string `json:"hashKey,omitempty"`
+}
+
+// applyUserID sets uid on the hit unless the visitor must not be identified.
+func applyUserID(req *http.Request, uc *UserIDConfig, hit *trackingHit) {
+	if uc == nil || hit.cookieless || hit.anonymous {
+		return
+	}
+	userID := resolveUserID(req, uc)
+	if userID == "" {
+		return
+	}
+	if uc.HashKey != "" {
+		mac := hmac.New(sha256.New, []byte(uc.HashKey))
+		mac.Write([]byte(userID))
+		userID = hex.EncodeToString(mac.Sum(nil))
+	}
+	hit.params.Set("uid", userID)
+}
+
+func resolveUserID(req *http.Request, uc *UserIDConfig) string {
+	switch uc.Source {
+	case userIDHeader:
+		return strings.TrimSpace(req.Header.Get(uc.Name))
+	case userIDCookie:
+		cookie, err := req.Cookie(uc.Name)
+		if err != nil {
+			return ""
+		}
+		return cookie.Value
+	case userIDJWT:
+		token := ""
+		if uc.Name != "" {
+			if cookie, err := req.Cookie(uc.Name); err == nil {
+				token = cookie.Value
+			}
+		} else if auth := req.Header.Get("Authorization"); len(auth) > 7 && strings.EqualFold(auth[:7], "Bearer ") {
+			token = strings.TrimSpace(auth[7:])
+		}
+		if token == "" {
+			return ""
+		}
+		claim := uc.Claim
+		if claim == "" {
+			claim = "sub"
+		}
+		return jwtClaim(token, claim)
+	default:
+		fmt.Println("Unknown user ID source:", uc.Source)
+		return ""
+	}
+}
+
+// jwtClaim decodes the payload of token and returns the claim at path.
+// The signature is not verified: the token is only used for analytics and
+// must already have been validated by the upstream service.
+func jwtClaim(token, path string) string {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		fmt.Println("Invalid JWT: expected 3 segments")
+		return ""
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		fmt.Println("Error decoding JWT payload:", err)
+		return ""
+	}
+	var doc interface{}
+	if err := json.Unmarshal(payload, &doc); err != nil {
+		fmt.Println("Error parsing JWT payload:", err)
+		return ""
+	}
+	value, ok := lookupJSONPath(doc, path)
+	if !ok {
+		return ""
+	}
+	return jsonScalarString(value)
+}
@@ -0,0 +1,53 @@
+package MatomoTracking
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func testJWT(payload string) string {
+	enc := base64.RawURLEncoding
+	return enc.EncodeToString([]byte(`{"alg":"HS256"}`)) + "." + enc.EncodeToString([]byte(payload)) + ".sig"
+}
+
+func TestApplyUserID(t *testing.T) {
+	t.Parallel()
+
+	token := testJWT(`{"sub":"42","user":{"email":"jane@example.com"}}`)
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write([]byte("jane@example.com"))
+	hashed := hex.EncodeToString(mac.Sum(nil))
+
+	cases := []struct {
+		name       string
+		uc         *UserIDConfig
+		setup      func(r *http.Request)
+		cookieless bool
+		want       string
+	}{
+		{"nil config", nil, func(r *http.Request) { r.Header.Set("X-Auth-User", "jane") }, false, ""},
+		{"header", &UserIDConfig{Source: userIDHeader, Name: "X-Auth-User"}, func(r *http.Request) { r.Header.Set("X-Auth-User", "jane") }, false, "jane"},
+		{"missing header", &UserIDConfig{Source: userIDHeader, Name: "X-Auth-User"}, func(r *http.Request) {}, false, ""},
+		{"cookie", &UserIDConfig{Source: userIDCookie, Name: "uid"}, func(r *http.Request) { r.AddCookie(&http.Cookie{Name: "uid", Value: "u-7"}) }, false, "u-7"},
+		{"bearer default claim", &UserIDConfig{Source: userIDJWT}, func(r *http.Request) { r.Header.Set("Authorization", "Bearer "+token) }, false, "42"},
+		{"cookie jwt nested claim hashed", &UserIDConfig{Source: userIDJWT, Name: "session", Claim: "user.email", HashKey: "secret"}, func(r *http.Request) { r.AddCookie(&http.Cookie{Name: "session", Value: token}) }, false, hashed},
+		{"malformed jwt", &UserIDConfig{Source: userIDJWT}, func(r *http.Request) { r.Header.Set("Authorization", "Bearer not-a-jwt") }, false, ""},
+		{"missing claim", &UserIDConfig{Source: userIDJWT, Claim: "tenant"}, func(r *http.Request) { r.Header.Set("Authorization", "Bearer "+token) }, false, ""},
+		{"cookieless omits uid", &UserIDConfig{Source: userIDHeader, Name: "X-Auth-User"}, func(r *http.Request) { r.Header.Set("X-Auth-User", "jane") }, true, ""},
+		{"unknown source", &UserIDConfig{Source: "ldap"}, func(r *http.Request) {}, false, ""},
+	}
+	for _, tc := range cases {
+		req := httptest.NewRequest(http.MethodGet, "http://example.com/", nil)
+		tc.setup(req)
+		hit := trackingHit{params: map[string][]string{}, cookieless: tc.cookieless}
+		applyUserID(req, tc.uc, &hit)
+		if got := hit.params.Get("uid"); got != tc.want {
+			t.Fatalf("%s: uid = %q; want %q", tc.name, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package MatomoTracking
+
+import (
+	"fmt"
+	"mime"
+	"regexp"
+	"strings"
+)
+
+// ValueMatcher matches the values of a header (or similar multi-valued field).
+// All configured criteria must hold for the same value; one matching value is enough.
+type ValueMatcher struct {
+	// Equals requires an exact value.
+	Equals string `json:"equals,omitempty"`
+	// EqualsFold requires a value equal under Unicode case folding.
+	EqualsFold string `json:"equalsFold,omitempty"`
+	// Prefix requires the value to start with the given string.
+	Prefix string `json:"prefix,omitempty"`
+	// Regex requires the value to match the regular expression.
+	Regex string `json:"regex,omitempty"`
+	// MediaType compares media types ignoring parameters and case, e.g. "text/html"
+	// matches "text/html;charset=utf-8". "text/*" matches any text type.
+	MediaType string `json:"mediaType,omitempty"`
+	// Present requires at least one value.
+	Present bool `json:"present,omitempty"`
+	// Absent requires no value at all. Other criteria are ignored.
+	Absent bool `json:"absent,omitempty"`
+}
+
+// matches reports whether values satisfy the matcher.
+func (vm ValueMatcher) matches(values []string) bool {
+	if vm.Absent {
+		return len(values) == 0
+	}
+	if len(values) == 0 {
+		return false
+	}
+	if vm.Equals == "" && vm.EqualsFold == "" && vm.Prefix == "" && vm.Regex == "" && vm.MediaType == "" {
+		// Presence only
+		return true
+	}
+
+	var re *regexp.Regexp
+	if vm.Regex != "" {
+		var err error
+		re, err = cachedRegexp(vm.Regex)
+		if err != nil {
+			fmt.Println("Error compiling value matcher regex:", err)
+			return false
+		}
+	}
+
+	for _, v := range values {
+		if vm.Equals != "" && v != vm.Equals {
+			continue
+		}
+		if vm.EqualsFold != "" && !strings.EqualFold(v, vm.EqualsFold) {
+			continue
+		}
+		if vm.Prefix != "" && !strings.HasPrefix(v, vm.Prefix) {
+			continue
+		}
+		if re != nil && !re.MatchString(v) {
+			continue
+		}
+		if vm.MediaType != "" && !matchesMediaType(v, vm.MediaType) {
+			continue
+		}
+		return true
+	}
+	return false
+}
+
+// matchesMediaType compares the media type of value with want, ignoring
+// parameters, whitespace and case. want may use a "type/*" wildcard.
+func matchesMediaType(value, want string) bool {
+	got := parseMediaType(value)
+	want = parseMediaType(want)
+	if strings.HasSuffix(want, "/*") {
+		return strings.HasPrefix(got, strings.TrimSuffix(want, "*"))
+	}
+	return got == want
+}
+
+func parseMediaType(value string) string {
+	if mediaType, _, err := mime.ParseMediaType(value); err == nil {
+		return mediaType
+	}
+	// Fall back to everything before the first parameter
+	mediaType, _, _ := strings.Cut(value, ";")
+	return strings.ToLower(strings.TrimSpace(mediaType))
+}
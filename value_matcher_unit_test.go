@@ -0,0 +1,59 @@
+package MatomoTracking
+
+import (
+	"testing"
+)
+
+func TestValueMatcher(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name   string
+		vm     ValueMatcher
+		values []string
+		want   bool
+	}{
+		{"equals", ValueMatcher{Equals: "web"}, []string{"web"}, true},
+		{"equals case", ValueMatcher{Equals: "web"}, []string{"WEB"}, false},
+		{"equalsFold", ValueMatcher{EqualsFold: "web"}, []string{"WEB"}, true},
+		{"prefix", ValueMatcher{Prefix: "text/"}, []string{"text/plain"}, true},
+		{"prefix mismatch", ValueMatcher{Prefix: "text/"}, []string{"application/json"}, false},
+		{"regex", ValueMatcher{Regex: `^max-age=\d+$`}, []string{"no-store", "max-age=60"}, true},
+		{"invalid regex", ValueMatcher{Regex: `(`}, []string{"x"}, false},
+		{"present", ValueMatcher{Present: true}, []string{""}, true},
+		{"present missing", ValueMatcher{Present: true}, nil, false},
+		{"absent", ValueMatcher{Absent: true}, nil, true},
+		{"absent present", ValueMatcher{Absent: true}, []string{"1"}, false},
+		{"empty matcher needs a value", ValueMatcher{}, nil, false},
+		{"combined criteria on same value", ValueMatcher{Prefix: "a", Regex: "z$"}, []string{"ab", "yz"}, false},
+		{"combined criteria match", ValueMatcher{Prefix: "a", Regex: "z$"}, []string{"ab", "az"}, true},
+	}
+	for _, tc := range cases {
+		if got := tc.vm.matches(tc.values); got != tc.want {
+			t.Fatalf("%s: matches(%q) = %v; want %v", tc.name, tc.values, got, tc.want)
+		}
+	}
+}
+
+func TestMatchesMediaType(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		value string
+		want  string
+		match bool
+	}{
+		{"text/html; charset=UTF-8", "text/html", true},
+		{"text/html;charset=utf-8", "text/html; charset=UTF-8", true},
+		{"TEXT/HTML", "text/html", true},
+		{"application/xhtml+xml", "text/html", false},
+		{"text/plain", "text/*", true},
+		{"application/json", "text/*", false},
+		{"text/html; charset=\"broken", "text/html", true},
+	}
+	for _, tc := range cases {
+		if got := matchesMediaType(tc.value, tc.want); got != tc.match {
+			t.Fatalf("matchesMediaType(%q, %q) = %v; want %v", tc.value, tc.want, got, tc.match)
+		}
+	}
+}